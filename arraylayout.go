@@ -0,0 +1,416 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"github.com/pkg/errors"
+)
+
+// This file implements the array-layout memory representation of
+// section 8.2 of rivest-draft.txt, in which each S-expression is a
+// type byte followed by a k-byte big-endian length and its contents:
+//
+//    01 <length> <octet-string>
+//    02 <length> 01 <length> <display-hint> 01 <length> <octet-string>
+//    03 <length> <item1> <item2> ... <itemn> 00
+//
+// A list's length includes its terminating 00.  k may be anywhere from
+// 2 to 8, and determines the largest representable S-expression.
+
+const (
+	arrayEnd    = 0x00
+	arrayAtom   = 0x01
+	arrayHinted = 0x02
+	arrayList   = 0x03
+)
+
+// ErrBadArrayLayout is reported by errors.Is for malformed
+// array-layout input.
+var ErrBadArrayLayout = errors.New("bad array layout")
+
+func checkK(k int) error {
+	if k < 2 || k > 8 {
+		return errors.Errorf("array layout: k must be from 2 to 8; got %d", k)
+	}
+	return nil
+}
+
+// PackArray returns the array-layout representation of s, with k-byte
+// lengths.  It fails if k is not from 2 to 8, or if any part of s is
+// too long for its length to fit in k bytes.
+func PackArray(s Sexp, k int) ([]byte, error) {
+	if err := checkK(k); err != nil {
+		return nil, err
+	}
+	size, err := arraySize(s, k)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 0, size)
+	return appendArray(b, s, k), nil
+}
+
+// arraySize returns the size in bytes of the array layout of s,
+// checking that every length fits in k bytes.
+func arraySize(s Sexp, k int) (size uint64, err error) {
+	max := uint64(1)<<(8*uint(k)) - 1
+	check := func(n uint64) error {
+		if n > max {
+			return errors.Errorf("array layout: length %d too large for %d-byte lengths", n, k)
+		}
+		return nil
+	}
+	switch s := s.(type) {
+	case Atom:
+		size = uint64(len(s.Value))
+		if err = check(size); err != nil {
+			return 0, err
+		}
+		size += uint64(1 + k)
+		if len(s.DisplayHint) > 0 {
+			hint := uint64(len(s.DisplayHint))
+			if err = check(hint); err != nil {
+				return 0, err
+			}
+			size += hint + uint64(1+k)
+			if err = check(size); err != nil {
+				return 0, err
+			}
+			size += uint64(1 + k)
+		}
+		return size, nil
+	case List:
+		size = 1 // the terminating 00
+		for _, element := range s {
+			n, err := arraySize(element, k)
+			if err != nil {
+				return 0, err
+			}
+			size += n
+		}
+		if err = check(size); err != nil {
+			return 0, err
+		}
+		return size + uint64(1+k), nil
+	default:
+		return 0, errors.Errorf("array layout: can't pack %T", s)
+	}
+}
+
+// putLength writes n to b[:k], big-endian.
+func putLength(b []byte, n int, k int) {
+	for i := k - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+}
+
+func appendLength(b []byte, n int, k int) []byte {
+	b = append(b, make([]byte, k)...)
+	putLength(b[len(b)-k:], n, k)
+	return b
+}
+
+func appendArray(b []byte, s Sexp, k int) []byte {
+	switch s := s.(type) {
+	case Atom:
+		if len(s.DisplayHint) > 0 {
+			b = append(b, arrayHinted)
+			b = appendLength(b, 2*(1+k)+len(s.DisplayHint)+len(s.Value), k)
+			b = append(b, arrayAtom)
+			b = appendLength(b, len(s.DisplayHint), k)
+			b = append(b, s.DisplayHint...)
+		}
+		b = append(b, arrayAtom)
+		b = appendLength(b, len(s.Value), k)
+		return append(b, s.Value...)
+	case List:
+		b = append(b, arrayList)
+		start := len(b)
+		b = appendLength(b, 0, k)
+		for _, element := range s {
+			b = appendArray(b, element, k)
+		}
+		b = append(b, arrayEnd)
+		// fill in the length, now that it is known
+		putLength(b[start:], len(b)-start-k, k)
+		return b
+	}
+	return b
+}
+
+// UnpackArray returns the S-expression whose array-layout
+// representation, with k-byte lengths, is exactly b.  The result does
+// not share memory with b.  It enforces DefaultLimits.
+func UnpackArray(b []byte, k int) (Sexp, error) {
+	return DefaultLimits.UnpackArray(b, k)
+}
+
+// UnpackArray returns the S-expression whose array-layout
+// representation is exactly b, as the package-level UnpackArray does,
+// enforcing l.
+func (l Limits) UnpackArray(b []byte, k int) (Sexp, error) {
+	v, err := l.NewArrayView(b, k)
+	if err != nil {
+		return nil, err
+	}
+	return v.Sexp(), nil
+}
+
+// An ArrayView is a read-only view of an S-expression in array layout.
+// It permits access to the elements of lists and the contents of atoms
+// in place, without unpacking the whole, and itself allocates nothing.
+// Its methods panic if used on the wrong kind of S-expression.
+type ArrayView struct {
+	b []byte // exactly the representation of the S-expression
+	k int
+}
+
+// NewArrayView returns a view of the S-expression whose array-layout
+// representation, with k-byte lengths, is exactly b.  b is checked in
+// full, so that the view's methods need not fail, and must not be
+// modified while the view is in use.  It enforces DefaultLimits.
+func NewArrayView(b []byte, k int) (ArrayView, error) {
+	return DefaultLimits.NewArrayView(b, k)
+}
+
+// NewArrayView returns a view of the S-expression whose array-layout
+// representation is exactly b, as the package-level NewArrayView does,
+// enforcing l.
+func (l Limits) NewArrayView(b []byte, k int) (ArrayView, error) {
+	if err := checkK(k); err != nil {
+		return ArrayView{}, err
+	}
+	if l.MaxBytes > 0 && int64(len(b)) > l.MaxBytes {
+		return ArrayView{}, &LimitError{Limit: "MaxBytes", Max: l.MaxBytes}
+	}
+	c := arrayChecker{b: b, k: k, limits: l}
+	n, err := c.check(0, 0)
+	if err != nil {
+		return ArrayView{}, err
+	}
+	if n != len(b) {
+		return ArrayView{}, arrayError(n, "unexpected data after S-expression")
+	}
+	return ArrayView{b: b, k: k}, nil
+}
+
+func arrayError(offset int, format string, args ...interface{}) error {
+	return errors.Wrapf(ErrBadArrayLayout, "offset %d: "+format, append([]interface{}{offset}, args...)...)
+}
+
+type arrayChecker struct {
+	b      []byte
+	k      int
+	limits Limits
+}
+
+// header returns the type and length of the S-expression at offset
+// off, and the offset of its contents.
+func (c *arrayChecker) header(off int) (typ byte, length int, contents int, err error) {
+	if off+1+c.k > len(c.b) {
+		return 0, 0, 0, arrayError(off, "truncated header")
+	}
+	typ = c.b[off]
+	var n uint64
+	for _, d := range c.b[off+1 : off+1+c.k] {
+		n = n<<8 | uint64(d)
+	}
+	contents = off + 1 + c.k
+	if n > uint64(len(c.b)-contents) {
+		return 0, 0, 0, arrayError(off, "length %d exceeds input", n)
+	}
+	return typ, int(n), contents, nil
+}
+
+// check checks the S-expression at offset off, returning the offset of
+// its end.
+func (c *arrayChecker) check(off, depth int) (int, error) {
+	typ, length, contents, err := c.header(off)
+	if err != nil {
+		return 0, err
+	}
+	end := contents + length
+	switch typ {
+	case arrayAtom:
+		if max := c.limits.MaxAtomLen; max > 0 && int64(length) > max {
+			return 0, &LimitError{Limit: "MaxAtomLen", Max: max}
+		}
+	case arrayHinted:
+		typ, n, hint, err := c.header(contents)
+		if err != nil {
+			return 0, err
+		}
+		if typ != arrayAtom || hint+n > end {
+			return 0, arrayError(contents, "expected display hint")
+		}
+		if n == 0 {
+			return 0, arrayError(contents, "empty display hint")
+		}
+		if max := c.limits.MaxHintLen; max > 0 && int64(n) > max {
+			return 0, &LimitError{Limit: "MaxHintLen", Max: max}
+		}
+		typ, n, value, err := c.header(hint + n)
+		if err != nil {
+			return 0, err
+		}
+		if typ != arrayAtom || value+n != end {
+			return 0, arrayError(hint+n, "expected octet string ending at offset %d", end)
+		}
+		if max := c.limits.MaxAtomLen; max > 0 && int64(n) > max {
+			return 0, &LimitError{Limit: "MaxAtomLen", Max: max}
+		}
+	case arrayList:
+		if max := c.limits.MaxDepth; max > 0 && depth >= max {
+			return 0, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+		}
+		if length == 0 || c.b[end-1] != arrayEnd {
+			return 0, arrayError(off, "list not terminated by 00")
+		}
+		count := 0
+		for off = contents; off < end-1; count++ {
+			if max := c.limits.MaxListLen; max > 0 && count >= max {
+				return 0, &LimitError{Limit: "MaxListLen", Max: int64(max)}
+			}
+			if off, err = c.check(off, depth+1); err != nil {
+				return 0, err
+			}
+			if off > end-1 {
+				return 0, arrayError(contents, "list elements exceed list length")
+			}
+		}
+	default:
+		return 0, arrayError(off, "unknown type %#02x", typ)
+	}
+	return end, nil
+}
+
+// header returns the type byte of v and its contents.
+func (v ArrayView) header() (byte, []byte) {
+	var n int
+	for _, d := range v.b[1 : 1+v.k] {
+		n = n<<8 | int(d)
+	}
+	return v.b[0], v.b[1+v.k : 1+v.k+n]
+}
+
+// next returns the S-expression at the start of b and the rest of b.
+func (v ArrayView) next(b []byte) (ArrayView, []byte) {
+	var n int
+	for _, d := range b[1 : 1+v.k] {
+		n = n<<8 | int(d)
+	}
+	return ArrayView{b: b[:1+v.k+n], k: v.k}, b[1+v.k+n:]
+}
+
+// IsList returns true if v is a list.
+func (v ArrayView) IsList() bool {
+	return len(v.b) > 0 && v.b[0] == arrayList
+}
+
+// Bytes returns the array-layout representation of v.
+func (v ArrayView) Bytes() []byte {
+	return v.b
+}
+
+// DisplayHint returns the display hint of the atom v, or nil if it has
+// none.
+func (v ArrayView) DisplayHint() []byte {
+	typ, contents := v.header()
+	switch typ {
+	case arrayAtom:
+		return nil
+	case arrayHinted:
+		hint, _ := v.next(contents)
+		_, b := hint.header()
+		return b
+	}
+	panic("sexprs: DisplayHint of array-layout list")
+}
+
+// Value returns the value of the atom v.
+func (v ArrayView) Value() []byte {
+	typ, contents := v.header()
+	switch typ {
+	case arrayAtom:
+		return contents
+	case arrayHinted:
+		_, rest := v.next(contents)
+		_, b := ArrayView{b: rest, k: v.k}.header()
+		return b
+	}
+	panic("sexprs: Value of array-layout list")
+}
+
+// elements returns the representations of the elements of the list v.
+func (v ArrayView) elements() []byte {
+	typ, contents := v.header()
+	if typ != arrayList {
+		panic("sexprs: elements of array-layout atom")
+	}
+	return contents[:len(contents)-1]
+}
+
+// Len returns the number of elements in the list v.  It takes time
+// proportional to that number.
+func (v ArrayView) Len() (n int) {
+	for b := v.elements(); len(b) > 0; n++ {
+		_, b = v.next(b)
+	}
+	return n
+}
+
+// Index returns element i of the list v.  It takes time proportional
+// to i; use First and Next to visit each element in turn.
+func (v ArrayView) Index(i int) ArrayView {
+	b := v.elements()
+	for ; len(b) > 0; i-- {
+		var element ArrayView
+		if element, b = v.next(b); i == 0 {
+			return element
+		}
+	}
+	panic("sexprs: array-layout list index out of range")
+}
+
+// First returns the first element of the list v.  ok is false if v is
+// empty.
+func (v ArrayView) First() (element ArrayView, ok bool) {
+	b := v.elements()
+	if len(b) == 0 {
+		return ArrayView{}, false
+	}
+	element, _ = v.next(b)
+	return element, true
+}
+
+// Next returns the element following element within the list v, which
+// must have been returned by First, Next or Index on v.  ok is false
+// if element is the last.
+func (v ArrayView) Next(element ArrayView) (next ArrayView, ok bool) {
+	b := v.elements()
+	start := cap(b) - cap(element.b) + len(element.b)
+	if start >= len(b) {
+		return ArrayView{}, false
+	}
+	next, _ = v.next(b[start:])
+	return next, true
+}
+
+// Sexp returns a copy of v as an Atom or List.
+func (v ArrayView) Sexp() Sexp {
+	if !v.IsList() {
+		a := Atom{Value: append([]byte{}, v.Value()...)}
+		if hint := v.DisplayHint(); hint != nil {
+			a.DisplayHint = append([]byte{}, hint...)
+		}
+		return a
+	}
+	l := List{}
+	for element, ok := v.First(); ok; element, ok = v.Next(element) {
+		l = append(l, element.Sexp())
+	}
+	return l
+}
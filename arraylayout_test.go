@@ -0,0 +1,134 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPackArray(t *testing.T) {
+	for _, test := range []struct {
+		sexp     string
+		expected string
+	}{
+		// the examples of section 8.2 of rivest-draft.txt
+		{"abc", "01 0003 616263"},
+		{"[gif]#61626364#", "02 000d 01 0003 676966 01 0004 61626364"},
+		{"(abc [d]ef (g))", "03 001b 01 0003 616263 02 0009 01 0001 64 01 0002 6566 03 0005 01 0001 67 00 00"},
+		{"()", "03 0001 00"},
+	} {
+		s, _, err := Parse([]byte(test.sexp))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := PackArray(s, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, _ := hex.DecodeString(strings.Replace(test.expected, " ", "", -1))
+		if !bytes.Equal(b, expected) {
+			t.Errorf("%s: expected %x; got %x", test.sexp, expected, b)
+		}
+		u, err := UnpackArray(b, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !u.Equal(s) {
+			t.Errorf("%s unpacked as %s", test.sexp, u)
+		}
+	}
+}
+
+func TestPackArrayK(t *testing.T) {
+	s := List{Atom{Value: []byte("foo")}, Atom{DisplayHint: []byte("bin"), Value: make([]byte, 300)}}
+	for k := 2; k <= 8; k++ {
+		b, err := PackArray(s, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := UnpackArray(b, k)
+		if err != nil {
+			t.Fatalf("k = %d: %v", k, err)
+		}
+		if !u.Equal(s) {
+			t.Errorf("k = %d: unpacked as %s", k, u)
+		}
+	}
+	for _, k := range []int{1, 9} {
+		if _, err := PackArray(s, k); err == nil {
+			t.Errorf("k = %d accepted", k)
+		}
+	}
+	// 65536 bytes needs a length of more than two bytes
+	if _, err := PackArray(Atom{Value: make([]byte, 1<<16)}, 2); err == nil {
+		t.Error("oversized atom accepted")
+	}
+}
+
+func TestUnpackArrayRejects(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"01 00",
+		"01 0004 616263",
+		"01 0002 616263",
+		"04 0000",
+		"03 0001 01",
+		"03 0004 01 0001 61",
+		"03 0005 01 0003 616263 00",
+		"02 0007 01 0000 01 0001 61",
+		"02 0008 03 0001 00 01 0001 61",
+		"02 0009 01 0001 62 01 0001 61",
+	} {
+		b, _ := hex.DecodeString(strings.Replace(input, " ", "", -1))
+		if _, err := UnpackArray(b, 2); !errors.Is(err, ErrBadArrayLayout) {
+			t.Errorf("%q: expected ErrBadArrayLayout; got %v", input, err)
+		}
+	}
+	b, _ := PackArray(List{List{List{}}}, 2)
+	if _, err := (Limits{MaxDepth: 2}).UnpackArray(b, 2); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected ErrLimitExceeded; got %v", err)
+	}
+}
+
+func TestArrayView(t *testing.T) {
+	s, _, _ := Parse([]byte("(abc [d]ef (g) ())"))
+	b, _ := PackArray(s, 4)
+	v, err := NewArrayView(b, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.IsList() || v.Len() != 4 {
+		t.Fatalf("expected list of 4; got %s", v.Sexp())
+	}
+	if e := v.Index(0); e.IsList() || string(e.Value()) != "abc" || e.DisplayHint() != nil {
+		t.Errorf("bad element 0: %s", e.Sexp())
+	}
+	if e := v.Index(1); string(e.DisplayHint()) != "d" || string(e.Value()) != "ef" {
+		t.Errorf("bad element 1: %s", e.Sexp())
+	}
+	if e := v.Index(2); !e.IsList() || e.Len() != 1 || string(e.Index(0).Value()) != "g" {
+		t.Errorf("bad element 2: %s", e.Sexp())
+	}
+	if _, ok := v.Index(3).First(); ok {
+		t.Error("empty list has a first element")
+	}
+	i := 0
+	for e, ok := v.First(); ok; e, ok = v.Next(e) {
+		if !bytes.Equal(e.Bytes(), v.Index(i).Bytes()) {
+			t.Errorf("element %d differs from Index", i)
+		}
+		i++
+	}
+	if i != 4 {
+		t.Errorf("iterated over %d elements", i)
+	}
+	if !v.Sexp().Equal(s) {
+		t.Errorf("view copied as %s", v.Sexp())
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// ReadCanonical reads a single S-expression in canonical representation
+// (section 6.1 of rivest-draft.txt) from r.  Unlike Read, it accepts
+// only verbatim atoms, with no leading zeros in their lengths and no
+// empty display hints, and lists with no whitespace, so that the bytes
+// read are exactly those that Pack would return for the result.  This
+// makes it suitable for reading data whose signature is to be checked.
+// It returns io.EOF only if r is at its end before the expression
+// begins.  It enforces DefaultLimits.
+func ReadCanonical(r *bufio.Reader) (s Sexp, err error) {
+	return DefaultLimits.ReadCanonical(r)
+}
+
+// ParseCanonical parses b, which must consist of exactly one
+// S-expression in canonical representation, as ReadCanonical does.  If
+// it returns no error then Pack will return b for the result.  It
+// enforces DefaultLimits.
+func ParseCanonical(b []byte) (s Sexp, err error) {
+	return DefaultLimits.ParseCanonical(b)
+}
+
+// canonicalByte reads a byte which must be present in a canonical
+// S-expression.
+func (p *reader) canonicalByte() (byte, error) {
+	c, err := p.readByte()
+	if err == io.EOF {
+		return 0, p.unexpectedEOF("")
+	}
+	return c, err
+}
+
+func (p *reader) readCanonical() (Sexp, error) {
+	c, err := p.canonicalByte()
+	if err != nil {
+		return nil, err
+	}
+	return p.readCanonicalFrom(c)
+}
+
+// readCanonicalFrom reads a canonical S-expression whose first byte is
+// first.
+func (p *reader) readCanonicalFrom(first byte) (Sexp, error) {
+	if first != '(' {
+		return p.readCanonicalAtom(first)
+	}
+	if p.limits.MaxDepth > 0 && p.depth >= p.limits.MaxDepth {
+		return nil, &LimitError{Limit: "MaxDepth", Max: int64(p.limits.MaxDepth)}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	l := List{}
+	for {
+		c, err := p.canonicalByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ')' {
+			return l, nil
+		}
+		if p.limits.MaxListLen > 0 && len(l) >= p.limits.MaxListLen {
+			return nil, &LimitError{Limit: "MaxListLen", Max: int64(p.limits.MaxListLen)}
+		}
+		element, err := p.readCanonicalFrom(c)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, element)
+	}
+}
+
+func (p *reader) readCanonicalAtom(first byte) (Sexp, error) {
+	var (
+		a   Atom
+		err error
+	)
+	if first == '[' {
+		start, line, col := p.n, p.line, int(p.n-p.lineStart)
+		if first, err = p.canonicalByte(); err != nil {
+			return nil, err
+		}
+		if a.DisplayHint, err = p.readVerbatim(first, true); err != nil {
+			return nil, err
+		}
+		if len(a.DisplayHint) == 0 {
+			return nil, p.syntaxErrorAt(start, line, col, ErrEmptyDisplayHint, "", "")
+		}
+		if first, err = p.canonicalByte(); err != nil {
+			return nil, err
+		}
+		if first != ']' {
+			return nil, p.unexpected(first, "']'")
+		}
+		if first, err = p.canonicalByte(); err != nil {
+			return nil, err
+		}
+	}
+	if a.Value, err = p.readVerbatim(first, false); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// readVerbatim reads a verbatim octet string, whose length begins with
+// first.  hint is true if the string is a display hint.
+func (p *reader) readVerbatim(first byte, hint bool) ([]byte, error) {
+	if bytes.IndexByte(decimalDigit, first) == -1 {
+		return nil, p.unexpected(first, "decimal length")
+	}
+	start, line, col := p.n-1, p.lastLine, p.lastCol
+	length := int64(first - '0')
+	for {
+		c, err := p.canonicalByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ':' {
+			break
+		}
+		if bytes.IndexByte(decimalDigit, c) == -1 {
+			return nil, p.unexpected(c, "decimal digit or ':'")
+		}
+		if length == 0 {
+			return nil, p.syntaxErrorAt(start, line, col, ErrBadLength, "length without leading zero", "")
+		}
+		if length > (1<<31-1)/10 {
+			return nil, p.syntaxErrorAt(start, line, col, ErrBadLength, "length of at most 2147483647", "")
+		}
+		length = length*10 + int64(c-'0')
+	}
+	if limit, max := p.maxLen(hint); max > 0 && length > max {
+		return nil, &LimitError{Limit: limit, Max: max}
+	}
+	b, err := p.readN(length)
+	if err != nil {
+		if se, ok := err.(*SyntaxError); ok {
+			se.Found = strconv.Itoa(len(b)) + " bytes"
+		}
+		return nil, err
+	}
+	return b, nil
+}
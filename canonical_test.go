@@ -0,0 +1,84 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseCanonical(t *testing.T) {
+	for _, input := range []string{
+		"0:",
+		"3:abc",
+		"()",
+		"(3:foo3:bar[3:bin]8:baz quux)",
+		"(7:subject(3:ref5:alice6:mother))",
+		"(4:icon[12:image/bitmap]9:xxxxxxxxx)",
+		"(()(()))",
+		"10:0123456789",
+	} {
+		s, err := ParseCanonical([]byte(input))
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if !bytes.Equal(s.Pack(), []byte(input)) {
+			t.Errorf("%q packed as %q", input, s.Pack())
+		}
+	}
+}
+
+func TestParseCanonicalRejects(t *testing.T) {
+	for input, expected := range map[string]struct {
+		kind   error
+		offset int64
+	}{
+		"":                   {io.ErrUnexpectedEOF, 0},
+		"abc":                {ErrUnexpectedCharacter, 0},
+		"03:abc":             {ErrBadLength, 0},
+		"(3:abc 3:def)":      {ErrUnexpectedCharacter, 6},
+		" 3:abc":             {ErrUnexpectedCharacter, 0},
+		"3:abc ":             {ErrTrailingData, 5},
+		"(3:abc":             {io.ErrUnexpectedEOF, 6},
+		"4:abc":              {io.ErrUnexpectedEOF, 5},
+		"#616263#":           {ErrUnexpectedCharacter, 0},
+		"3|YWJj|":            {ErrUnexpectedCharacter, 1},
+		"{KDE6YTE6YjE6Yyk=}": {ErrUnexpectedCharacter, 0},
+		"[0:]3:abc":          {ErrEmptyDisplayHint, 1},
+		"[3:bin3:abc":        {ErrUnexpectedCharacter, 6},
+		"99999999999:a":      {ErrBadLength, 0},
+	} {
+		_, err := ParseCanonical([]byte(input))
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: expected SyntaxError; got %v", input, err)
+			continue
+		}
+		if !errors.Is(err, expected.kind) || se.Offset != expected.offset {
+			t.Errorf("%q: expected %v at offset %d; got %v", input, expected.kind, expected.offset, err)
+		}
+	}
+}
+
+func TestReadCanonical(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("(1:a)1:b"))
+	for _, expected := range []string{"(1:a)", "1:b"} {
+		s, err := ReadCanonical(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(s.Pack()) != expected {
+			t.Fatalf("expected %s; got %s", expected, s.Pack())
+		}
+	}
+	if _, err := ReadCanonical(r); err != io.EOF {
+		t.Fatalf("expected io.EOF; got %v", err)
+	}
+}
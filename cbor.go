@@ -0,0 +1,204 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// CBORHintTag is the CBOR tag marking a display-hinted atom.  It is
+// not registered with IANA; it spells "sexp" in ASCII.
+const CBORHintTag = 0x73657870
+
+// CBOR major types (c.f. section 3.1 of RFC 8949)
+const (
+	cborBytes = 2
+	cborText  = 3
+	cborArray = 4
+	cborTag   = 6
+)
+
+// ToCBOR returns the CBOR (RFC 8949) encoding of s.  An atom is
+// encoded as a byte string, unless it has a display hint, when it is
+// encoded as an array of its hint and its value, both byte strings,
+// tagged with CBORHintTag.  A list is encoded as an array of its
+// elements.  The encoding is deterministic, in the sense of section
+// 4.2.1 of RFC 8949: lengths are definite and as short as possible.
+func ToCBOR(s Sexp) ([]byte, error) {
+	return appendCBOR(nil, s)
+}
+
+func appendCBOR(b []byte, s Sexp) ([]byte, error) {
+	switch s := s.(type) {
+	case Atom:
+		if len(s.DisplayHint) > 0 {
+			b = appendCBORHead(b, cborTag, CBORHintTag)
+			b = appendCBORHead(b, cborArray, 2)
+			b = append(appendCBORHead(b, cborBytes, uint64(len(s.DisplayHint))), s.DisplayHint...)
+		}
+		return append(appendCBORHead(b, cborBytes, uint64(len(s.Value))), s.Value...), nil
+	case List:
+		b = appendCBORHead(b, cborArray, uint64(len(s)))
+		for _, element := range s {
+			var err error
+			if b, err = appendCBOR(b, element); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, errors.Errorf("can't encode %T as CBOR", s)
+}
+
+// appendCBORHead appends the initial byte, and any following bytes,
+// of a data item of major type major and argument n, in the shortest
+// form.
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	major <<= 5
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= 0xff:
+		return append(b, major|24, byte(n))
+	case n <= 0xffff:
+		return appendBigEndian(append(b, major|25), n, 2)
+	case n <= 0xffffffff:
+		return appendBigEndian(append(b, major|26), n, 4)
+	}
+	return appendBigEndian(append(b, major|27), n, 8)
+}
+
+// appendBigEndian appends the size low-order bytes of n to b, most
+// significant first.
+func appendBigEndian(b []byte, n uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		b = append(b, byte(n>>(8*uint(i))))
+	}
+	return b
+}
+
+// FromCBOR decodes the CBOR encoding of an S-expression, as returned
+// by ToCBOR, which must be all of b.  Text strings are accepted as
+// atoms, and non-deterministic lengths are tolerated, but other types,
+// indefinite lengths and other tags are not.  Lists may be nested no
+// more deeply than DefaultLimits permits.
+func FromCBOR(b []byte) (Sexp, error) {
+	d := &cborDecoder{b: b, n: len(b)}
+	s, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.b) > 0 {
+		return nil, d.errorf("unexpected data after S-expression")
+	}
+	return s, nil
+}
+
+type cborDecoder struct {
+	b     []byte // the remaining input
+	n     int    // the length of the whole input
+	depth int
+}
+
+func (d *cborDecoder) errorf(format string, args ...interface{}) error {
+	return errors.Wrapf(errors.Errorf(format, args...), "CBOR: offset %d", d.n-len(d.b))
+}
+
+// eof reports that the input ends within a data item.
+func (d *cborDecoder) eof() error {
+	return errors.Wrapf(io.ErrUnexpectedEOF, "CBOR: offset %d", d.n)
+}
+
+// head reads the head of a data item.
+func (d *cborDecoder) head() (major byte, n uint64, err error) {
+	if len(d.b) == 0 {
+		return 0, 0, d.eof()
+	}
+	major, info := d.b[0]>>5, d.b[0]&0x1f
+	var size int
+	switch {
+	case info < 24:
+		d.b = d.b[1:]
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	case info == 31:
+		return 0, 0, d.errorf("indefinite lengths unsupported")
+	default:
+		return 0, 0, d.errorf("reserved additional information %d", info)
+	}
+	if len(d.b) < 1+size {
+		return 0, 0, d.eof()
+	}
+	for _, c := range d.b[1 : 1+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[1+size:]
+	return major, n, nil
+}
+
+func (d *cborDecoder) decode() (Sexp, error) {
+	start := d.b
+	major, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborBytes, cborText:
+		if n > uint64(len(d.b)) {
+			return nil, d.eof()
+		}
+		a := Atom{Value: append([]byte{}, d.b[:n]...)}
+		d.b = d.b[n:]
+		return a, nil
+	case cborArray:
+		// each element occupies at least a byte
+		if n > uint64(len(d.b)) {
+			return nil, d.eof()
+		}
+		if max := DefaultLimits.MaxDepth; max > 0 && d.depth >= max {
+			return nil, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+		l := List{}
+		for i := uint64(0); i < n; i++ {
+			element, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, element)
+		}
+		return l, nil
+	case cborTag:
+		if n != CBORHintTag {
+			d.b = start
+			return nil, d.errorf("unsupported tag %d", n)
+		}
+		// tags nest as arrays do
+		if max := DefaultLimits.MaxDepth; max > 0 && d.depth >= max {
+			return nil, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+		}
+		d.depth++
+		defer func() { d.depth-- }()
+		tagged, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		if l, ok := tagged.(List); ok && len(l) == 2 {
+			hint, hintOK := l[0].(Atom)
+			value, valueOK := l[1].(Atom)
+			if hintOK && valueOK && len(hint.DisplayHint) == 0 && len(value.DisplayHint) == 0 && len(hint.Value) > 0 {
+				return Atom{DisplayHint: hint.Value, Value: value.Value}, nil
+			}
+		}
+		d.b = start
+		return nil, d.errorf("hinted atom is not an array of two strings")
+	}
+	d.b = start
+	return nil, d.errorf("unsupported major type %d", major)
+}
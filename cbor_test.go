@@ -0,0 +1,96 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCBOR(t *testing.T) {
+	for _, test := range []struct {
+		sexp, cbor string // cbor in hexadecimal
+	}{
+		{`""`, "40"},
+		{"foo", "43666f6f"},
+		{"()", "80"},
+		{"(a (b) ())", "83416181416280"},
+		{"[h]a", "da736578708241684161"},
+		{"(a [text/plain]b)", "824161da73657870824a746578742f706c61696e4162"},
+		{`|` + strings.Repeat("A", 32) + `|`, "5818" + strings.Repeat("00", 24)},
+		{`|` + strings.Repeat("A", 344) + `|`, "590102" + strings.Repeat("00", 258)},
+	} {
+		s := parseString(t, test.sexp)
+		b, err := ToCBOR(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(b) != test.cbor {
+			t.Errorf("%s: expected %s; got %x", test.sexp, test.cbor, b)
+		}
+		result, err := FromCBOR(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.sexp, err)
+			continue
+		}
+		if !bytes.Equal(result.Pack(), s.Pack()) {
+			t.Errorf("%s: decoded as %s", test.sexp, result)
+		}
+	}
+}
+
+func TestFromCBOR(t *testing.T) {
+	for _, test := range []struct {
+		cbor, sexp string
+	}{
+		{"63666f6f", "foo"},
+		{"9800", "()"},
+		{"5803666f6f", "foo"},
+		{"db00000000736578708261684161", "[h]a"},
+	} {
+		b, _ := hex.DecodeString(test.cbor)
+		s, err := FromCBOR(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.cbor, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.sexp)) {
+			t.Errorf("%s: expected %s; got %s", test.cbor, test.sexp, s)
+		}
+	}
+	for _, test := range []struct {
+		cbor string
+		err  error
+	}{
+		{"", io.ErrUnexpectedEOF},
+		{"43666f", io.ErrUnexpectedEOF},
+		{"82", io.ErrUnexpectedEOF},
+		{"9affffffff", io.ErrUnexpectedEOF},
+		{"5b", io.ErrUnexpectedEOF},
+		{"01", nil},
+		{"a0", nil},
+		{"f6", nil},
+		{"5f4161ff", nil},
+		{"1c", nil},
+		{"c1414141", nil},
+		{"da73657870814168", nil},
+		{"da7365787082404161", nil},
+		{"da736578708241688141", nil},
+		{"4161" + "4162", nil},
+		{strings.Repeat("81", 1025) + "80", ErrLimitExceeded},
+		{strings.Repeat("da73657870", 1025) + "80", ErrLimitExceeded},
+		{strings.Repeat("da7365787082", 1025) + "80", ErrLimitExceeded},
+	} {
+		b, _ := hex.DecodeString(test.cbor)
+		s, err := FromCBOR(b)
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%s: expected error %v; got %v, %v", test.cbor, test.err, s, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/eadmund/sexprs"
+)
+
+var convertCommand = command{
+	usage: "[-to representation] [-width n] [file ...]",
+	help:  "convert S-expressions to another representation",
+	flags: func(fs *flag.FlagSet, e *env) func(args []string) error {
+		to := fs.String("to", "advanced", "the `representation` to write: canonical, advanced, pretty or transport")
+		width := fs.Int("width", sexprs.DefaultPrinter.Width, "the line width aimed for by -to pretty")
+		return func(args []string) error {
+			enc, err := newEncoder(e.stdout, *to, *width)
+			if err != nil {
+				return err
+			}
+			return e.eachSexp(args, enc.Encode)
+		}
+	},
+}
+
+// newEncoder returns an Encoder writing the representation named rep to
+// w, laying out pretty output within width.
+func newEncoder(w io.Writer, rep string, width int) (*sexprs.Encoder, error) {
+	r, pretty, err := parseRepresentation(rep)
+	if err != nil {
+		return nil, err
+	}
+	enc := sexprs.NewEncoder(w)
+	enc.SetRepresentation(r)
+	if pretty {
+		p := *sexprs.DefaultPrinter
+		p.Width = width
+		enc.SetPrinter(&p)
+	}
+	return enc, nil
+}
+
+var validateCommand = command{
+	usage: "[-v] [file ...]",
+	help:  "check the syntax of S-expressions",
+	flags: func(fs *flag.FlagSet, e *env) func(args []string) error {
+		verbose := fs.Bool("v", false, "report the number of S-expressions in each valid file")
+		return func(args []string) error {
+			if len(args) == 0 {
+				args = []string{"-"}
+			}
+			valid := true
+			// report every invalid file, not just the first
+			for _, file := range args {
+				n := 0
+				err := e.eachSexpIn(file, func(sexprs.Sexp) error {
+					n++
+					return nil
+				})
+				switch {
+				case err != nil:
+					fmt.Fprintln(e.stderr, err)
+					valid = false
+				case *verbose:
+					name := file
+					if name == "-" {
+						name = "<stdin>"
+					}
+					fmt.Fprintf(e.stdout, "%s: %d S-expressions\n", name, n)
+				}
+			}
+			if !valid {
+				return errInvalid
+			}
+			return nil
+		}
+	},
+}
@@ -0,0 +1,190 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+var editCommand = command{
+	usage: "[-to representation] [-w] {-set query=sexp | -delete query | -insert query=sexp | -append query=sexp} ... [file ...]",
+	help:  "set, delete or insert subexpressions",
+	flags: func(fs *flag.FlagSet, e *env) func(args []string) error {
+		to := fs.String("to", "canonical", "the `representation` to write: canonical, advanced, pretty or transport")
+		width := fs.Int("width", sexprs.DefaultPrinter.Width, "the line width aimed for by -to pretty")
+		write := fs.Bool("w", false, "write the result back to each file, once all are edited, rather than to standard output")
+		var edits []edit
+		for _, op := range []struct{ name, usage string }{
+			{"set", "replace each subexpression selected by `query=sexp` with sexp"},
+			{"delete", "delete each subexpression selected by `query`"},
+			{"insert", "insert sexp before each subexpression selected by `query=sexp`"},
+			{"append", "append sexp to each list selected by `query=sexp`"},
+		} {
+			fs.Var(editFlag{op: op.name, edits: &edits}, op.name, op.usage)
+		}
+		return func(args []string) error {
+			if len(edits) == 0 {
+				return errors.New("no edits given")
+			}
+			apply := func(s sexprs.Sexp) (sexprs.Sexp, error) {
+				for _, ed := range edits {
+					var err error
+					if s, err = ed.apply(s); err != nil {
+						return nil, err
+					}
+				}
+				return s, nil
+			}
+			if !*write {
+				enc, err := newEncoder(e.stdout, *to, *width)
+				if err != nil {
+					return err
+				}
+				return e.eachSexp(args, func(s sexprs.Sexp) error {
+					s, err := apply(s)
+					if err != nil {
+						return err
+					}
+					return enc.Encode(s)
+				})
+			}
+			if len(args) == 0 {
+				return errors.New("-w requires files")
+			}
+			// nothing is written unless every edit of every file
+			// succeeds
+			results := make([][]byte, len(args))
+			for i, file := range args {
+				if file == "-" {
+					return errors.New("-w can't write to standard input")
+				}
+				buf := bytes.NewBuffer(nil)
+				enc, err := newEncoder(buf, *to, *width)
+				if err != nil {
+					return err
+				}
+				err = e.eachSexpIn(file, func(s sexprs.Sexp) error {
+					s, err := apply(s)
+					if err != nil {
+						return err
+					}
+					return enc.Encode(s)
+				})
+				if err != nil {
+					return errors.Wrap(err, file)
+				}
+				results[i] = buf.Bytes()
+			}
+			for i, file := range args {
+				if err := os.WriteFile(file, results[i], 0666); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	},
+}
+
+// An edit is an edit of the subexpressions selected by a query.
+type edit struct {
+	op    string // set, delete, insert or append
+	query *sexprs.Query
+	value sexprs.Sexp // unless op is delete
+}
+
+// editFlag adds an edit with op to edits each time it is set.
+type editFlag struct {
+	op    string
+	edits *[]edit
+}
+
+func (f editFlag) String() string {
+	return ""
+}
+
+func (f editFlag) Set(arg string) error {
+	ed := edit{op: f.op}
+	query := arg
+	if f.op != "delete" {
+		i := assignment(arg)
+		if i == -1 {
+			return errors.Errorf("expected query=sexp; got %q", arg)
+		}
+		query = arg[:i]
+		s, rest, err := sexprs.Parse([]byte(arg[i+1:]))
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(rest)) > 0 {
+			return errors.Errorf("unexpected data after S-expression: %q", rest)
+		}
+		ed.value = s
+	}
+	q, err := sexprs.CompileQuery(query)
+	if err != nil {
+		return err
+	}
+	ed.query = q
+	*f.edits = append(*f.edits, ed)
+	return nil
+}
+
+// assignment returns the index of the = separating the query from the
+// S-expression in arg, ignoring those within the query's predicates,
+// or -1 if there is none.
+func assignment(arg string) int {
+	depth := 0
+	for i, c := range arg {
+		switch {
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '=' && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// apply applies ed to s.  It is an error for the query to select
+// nothing.
+func (ed edit) apply(s sexprs.Sexp) (sexprs.Sexp, error) {
+	matches := ed.query.Select(s)
+	if len(matches) == 0 {
+		return nil, errors.Errorf("%s %s: no match", ed.op, ed.query)
+	}
+	var patch sexprs.Patch
+	// editing from the end of s backwards leaves the paths of earlier
+	// matches intact
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		switch ed.op {
+		case "set":
+			patch = append(patch, sexprs.Edit{Op: sexprs.EditReplace, Path: m.Path, New: ed.value})
+		case "delete":
+			patch = append(patch, sexprs.Edit{Op: sexprs.EditDelete, Path: m.Path})
+		case "insert":
+			patch = append(patch, sexprs.Edit{Op: sexprs.EditInsert, Path: m.Path, New: ed.value})
+		case "append":
+			l, ok := m.Sexp.(sexprs.List)
+			if !ok {
+				return nil, errors.Errorf("append %s: %s is not a list", ed.query, m.Sexp)
+			}
+			path := append(append([]int{}, m.Path...), len(l))
+			patch = append(patch, sexprs.Edit{Op: sexprs.EditInsert, Path: path, New: ed.value})
+		}
+	}
+	s, err := patch.Apply(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s %s", ed.op, ed.query)
+	}
+	return s, nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+// Command sexp processes S-expressions.
+//
+// Usage:
+//    sexp command [flags] [file ...]
+//
+// The commands are:
+//    convert     convert S-expressions to another representation
+//    edit        set, delete or insert subexpressions
+//    query       print the subexpressions selected by a path query or pattern
+//    validate    check the syntax of S-expressions
+//
+// Each command reads every S-expression in each file named, or in its
+// standard input if none is named or a file is named -.  A file may
+// contain any number of S-expressions, in any mixture of the canonical,
+// advanced and transport representations.  Run sexp help command for
+// the flags of each command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+// A command is a subcommand of sexp.
+type command struct {
+	usage string // arguments, after the name of the command
+	help  string // a one-line description
+	// flags defines the command's flags on fs, and returns the function
+	// which runs it, once fs has been parsed
+	flags func(fs *flag.FlagSet, env *env) func(args []string) error
+}
+
+var commands = map[string]command{
+	"convert":  convertCommand,
+	"edit":     editCommand,
+	"query":    queryCommand,
+	"validate": validateCommand,
+}
+
+// env is the environment in which a command runs.
+type env struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+}
+
+// errInvalid is returned by a command which has already reported the
+// invalid input it found.
+var errInvalid = errors.New("invalid input")
+
+func main() {
+	os.Exit(run(os.Args[1:], &env{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}))
+}
+
+// run runs the command named by args[0], returning the exit status.
+func run(args []string, e *env) int {
+	if len(args) == 0 {
+		usage(e.stderr)
+		return 2
+	}
+	name, args := args[0], args[1:]
+	output := e.stderr
+	if name == "help" {
+		if len(args) == 0 {
+			usage(e.stdout)
+			return 0
+		}
+		name, args, output = args[0], []string{"-h"}, e.stdout
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(e.stderr, "sexp: unknown command %q\n", name)
+		usage(e.stderr)
+		return 2
+	}
+	fs := flag.NewFlagSet("sexp "+name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: sexp %s %s\n\n%s\n\n", name, cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	runCommand := cmd.flags(fs, e)
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if err := runCommand(fs.Args()); err != nil {
+		if err != errInvalid {
+			fmt.Fprintf(e.stderr, "sexp %s: %v\n", name, err)
+		}
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "usage: sexp command [flags] [file ...]\n\nThe commands are:\n")
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "    %-10s  %s\n", name, commands[name].help)
+	}
+	fmt.Fprintf(w, "\nRun sexp help command for the flags of each command.\n")
+}
+
+// eachSexp calls fn with every S-expression in each of files, or in
+// e.stdin if files is empty, stopping at the first error.  Syntax
+// errors are prefixed with the name of the file in which they occur.
+func (e *env) eachSexp(files []string, fn func(s sexprs.Sexp) error) error {
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, file := range files {
+		if err := e.eachSexpIn(file, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachSexpIn calls fn with every S-expression in file.
+func (e *env) eachSexpIn(file string, fn func(s sexprs.Sexp) error) error {
+	r, name := e.stdin, "<stdin>"
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, name = f, file
+	}
+	d := sexprs.NewDecoder(r)
+	for {
+		s, err := d.Decode()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return errors.Wrap(err, name)
+		}
+		if err = fn(s); err != nil {
+			return err
+		}
+	}
+}
+
+// parseRepresentation returns the representation named name: one of
+// canonical, advanced, pretty or transport.  pretty is the advanced
+// representation, laid out by a Printer.
+func parseRepresentation(name string) (rep sexprs.Representation, pretty bool, err error) {
+	switch name {
+	case "canonical":
+		return sexprs.Canonical, false, nil
+	case "advanced":
+		return sexprs.Advanced, false, nil
+	case "pretty":
+		return sexprs.Advanced, true, nil
+	case "transport":
+		return sexprs.Transport, false, nil
+	}
+	return 0, false, errors.Errorf("unknown representation %q", name)
+}
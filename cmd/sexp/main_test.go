@@ -0,0 +1,215 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runWith runs sexp with args and stdin, returning its exit status and
+// output.
+func runWith(args []string, stdin string) (status int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	status = run(args, &env{stdin: strings.NewReader(stdin), stdout: &out, stderr: &errOut})
+	return status, out.String(), errOut.String()
+}
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConvert(t *testing.T) {
+	const input = `(foo bar [bin]"baz quux") {KDM6Zm9vKQ==} (1:a1:b)`
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"convert"}, "(foo bar [bin]\"baz quux\")\n(foo)\n(a b)\n"},
+		{[]string{"convert", "-to", "advanced"}, "(foo bar [bin]\"baz quux\")\n(foo)\n(a b)\n"},
+		{[]string{"convert", "-to", "canonical"}, "(3:foo3:bar[3:bin]8:baz quux)(3:foo)(1:a1:b)"},
+		{[]string{"convert", "-to", "transport"}, "{KDM6Zm9vMzpiYXJbMzpiaW5dODpiYXogcXV1eCk=}\n{KDM6Zm9vKQ==}\n{KDE6YTE6Yik=}\n"},
+		{[]string{"convert", "-to", "pretty", "-width", "10"}, "(foo\n  bar\n  [bin]\"baz quux\")\n(foo)\n(a b)\n"},
+		{[]string{"convert", "-"}, "(foo bar [bin]\"baz quux\")\n(foo)\n(a b)\n"},
+	} {
+		status, stdout, stderr := runWith(test.args, input)
+		if status != 0 || stderr != "" {
+			t.Errorf("%v: exited %d: %s", test.args, status, stderr)
+		}
+		if stdout != test.expected {
+			t.Errorf("%v: expected %q; got %q", test.args, test.expected, stdout)
+		}
+	}
+}
+
+func TestConvertFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.sexp", "(a)\n")
+	b := writeFile(t, dir, "b.sexp", "(b)(c)")
+	status, stdout, stderr := runWith([]string{"convert", "-to", "canonical", a, "-", b}, "(stdin)")
+	if status != 0 || stdout != "(1:a)(5:stdin)(1:b)(1:c)" {
+		t.Errorf("exited %d with %q: %s", status, stdout, stderr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	good := writeFile(t, dir, "good.sexp", "(a b)\n(c)\n")
+	bad := writeFile(t, dir, "bad.sexp", "(a b)\n(c [d)\n")
+	status, stdout, stderr := runWith([]string{"validate", "-v", good}, "")
+	if status != 0 || stdout != good+": 2 S-expressions\n" || stderr != "" {
+		t.Errorf("exited %d with %q: %s", status, stdout, stderr)
+	}
+	status, stdout, stderr = runWith([]string{"validate", bad, good, filepath.Join(dir, "missing")}, "")
+	if status != 1 {
+		t.Errorf("expected failure; exited %d", status)
+	}
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], bad+": line 2, column 6 (offset 11): unexpected character") {
+		t.Errorf("unexpected errors %q", stderr)
+	}
+	if stdout != "" {
+		t.Errorf("unexpected output %q", stdout)
+	}
+	if status, _, stderr = runWith([]string{"validate"}, "(a"); status != 1 || !strings.HasPrefix(stderr, "<stdin>: ") {
+		t.Errorf("exited %d: %s", status, stderr)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	for _, test := range []struct {
+		args   []string
+		status int
+	}{
+		{nil, 2},
+		{[]string{"frobnicate"}, 2},
+		{[]string{"help"}, 0},
+		{[]string{"help", "convert"}, 0},
+		{[]string{"convert", "-bogus"}, 2},
+		{[]string{"convert", "-to", "bogus"}, 1},
+		{[]string{"convert", "missing-file"}, 1},
+	} {
+		if status, _, _ := runWith(test.args, ""); status != test.status {
+			t.Errorf("%v: expected status %d; got %d", test.args, test.status, status)
+		}
+	}
+	if _, stdout, _ := runWith([]string{"help", "convert"}, ""); !strings.Contains(stdout, "-to representation") {
+		t.Errorf("help convert: %q", stdout)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	const input = `(cert (issuer (hash sha256 #01#)) (subject (ref alice mother)) (tag (ftp (ref bob))))
+		(cert (subject (ref carol)))`
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"query", "/cert/subject/ref[1]"}, "alice\ncarol\n"},
+		{[]string{"query", "-paths", "//ref"}, "/2/1\t(ref alice mother)\n/3/1/1\t(ref bob)\n/1/1\t(ref carol)\n"},
+		{[]string{"query", "-to", "canonical", "//hash/*"}, "6:sha2561:\x01"},
+		{[]string{"query", "(ref ?x ?rest...)"}, "(ref alice mother)\n(ref bob)\n(ref carol)\n"},
+		{[]string{"query", "-bind", "x", "(ref ?x ?)"}, "alice\n"},
+		{[]string{"query", "-bind", "s", "(cert ? (subject ?s) ?...)"}, "(ref alice mother)\n"},
+		{[]string{"query", "/nothing"}, ""},
+	} {
+		status, stdout, stderr := runWith(test.args, input)
+		if status != 0 || stderr != "" {
+			t.Errorf("%v: exited %d: %s", test.args, status, stderr)
+		}
+		if stdout != test.expected {
+			t.Errorf("%v: expected %q; got %q", test.args, test.expected, stdout)
+		}
+	}
+	for _, args := range [][]string{
+		{"query"},
+		{"query", "/cert["},
+		{"query", "(cert"},
+		{"query", "-bind", "x", "/cert"},
+		{"query", "-paths", "-bind", "x", "(ref ?x ?)"},
+	} {
+		if status, _, _ := runWith(args, input); status != 1 {
+			t.Errorf("%v: expected failure; exited %d", args, status)
+		}
+	}
+}
+
+func TestEdit(t *testing.T) {
+	const input = `(config (port "80") (host a.example.com) (user www))`
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"edit", "-to", "advanced", "-set", `/config/port[1]="8080"`}, `(config (port "8080") (host a.example.com) (user www))` + "\n"},
+		{[]string{"edit", "-set", `/config/*[head=port]=(port "8080")`}, "(6:config(4:port4:8080)(4:host13:a.example.com)(4:user3:www))"},
+		{[]string{"edit", "-to", "advanced", "-delete", "/config/user", "-delete", "/config/host"}, `(config (port "80"))` + "\n"},
+		{[]string{"edit", "-to", "advanced", "-delete", "/config/*"}, "(config)\n"},
+		{[]string{"edit", "-to", "advanced", "-insert", "/config/host=(debug)"}, `(config (port "80") (debug) (host a.example.com) (user www))` + "\n"},
+		{[]string{"edit", "-to", "advanced", "-append", "/config=(debug)", "-append", "/config/user=wheel"},
+			`(config (port "80") (host a.example.com) (user www wheel) (debug))` + "\n"},
+		{[]string{"edit", "-to", "advanced", "-set", "/*=(replaced)"}, "(replaced)\n"},
+	} {
+		status, stdout, stderr := runWith(test.args, input)
+		if status != 0 || stderr != "" {
+			t.Errorf("%v: exited %d: %s", test.args, status, stderr)
+		}
+		if stdout != test.expected {
+			t.Errorf("%v: expected %q; got %q", test.args, test.expected, stdout)
+		}
+	}
+	for _, args := range [][]string{
+		{"edit"},
+		{"edit", "-set", "/config/port"},
+		{"edit", "-set", "/config/port=(a"},
+		{"edit", "-set", "/config/port=a b"},
+		{"edit", "-set", "/config/missing=a"},
+		{"edit", "-delete", "/*"},
+		{"edit", "-append", "/config/port[1]=a"},
+		{"edit", "-w", "-delete", "/config/user"},
+	} {
+		if status, _, _ := runWith(args, input); status == 0 {
+			t.Errorf("%v: expected failure", args)
+		}
+	}
+}
+
+func TestEditInPlace(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.sexp", "(config (port \"80\"))\n(config (port \"81\"))")
+	b := writeFile(t, dir, "b.sexp", "(config)")
+	status, _, stderr := runWith([]string{"edit", "-w", "-append", "/config=(user www)", a, b}, "")
+	if status != 0 {
+		t.Fatalf("exited %d: %s", status, stderr)
+	}
+	for file, expected := range map[string]string{
+		a: "(6:config(4:port2:80)(4:user3:www))(6:config(4:port2:81)(4:user3:www))",
+		b: "(6:config(4:user3:www))",
+	} {
+		if contents, err := os.ReadFile(file); err != nil || string(contents) != expected {
+			t.Errorf("%s: expected %q; got %q, %v", file, expected, contents, err)
+		}
+	}
+	// a failed edit leaves the file untouched
+	if status, _, _ = runWith([]string{"edit", "-w", "-delete", "/config/port", b}, ""); status != 1 {
+		t.Errorf("expected failure; exited %d", status)
+	}
+	if contents, _ := os.ReadFile(b); string(contents) != "(6:config(4:user3:www))" {
+		t.Errorf("%s modified: %q", b, contents)
+	}
+	// as does a failed edit of a later file
+	if status, _, _ = runWith([]string{"edit", "-w", "-delete", "/config/port", a, b}, ""); status != 1 {
+		t.Errorf("expected failure; exited %d", status)
+	}
+	if contents, _ := os.ReadFile(a); string(contents) != "(6:config(4:port2:80)(4:user3:www))(6:config(4:port2:81)(4:user3:www))" {
+		t.Errorf("%s modified: %q", a, contents)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+var queryCommand = command{
+	usage: "[-to representation] [-width n] [-paths] [-bind name] expression [file ...]",
+	help:  "print the subexpressions selected by a path query or pattern",
+	flags: func(fs *flag.FlagSet, e *env) func(args []string) error {
+		to := fs.String("to", "advanced", "the `representation` to write: canonical, advanced, pretty or transport")
+		width := fs.Int("width", sexprs.DefaultPrinter.Width, "the line width aimed for by -to pretty")
+		paths := fs.Bool("paths", false, "print the path of each match before it")
+		bind := fs.String("bind", "", "print the binding of the pattern variable `name` rather than each match")
+		return func(args []string) error {
+			if len(args) == 0 {
+				return errors.New("no expression given")
+			}
+			if *paths && *bind != "" {
+				// a binding, e.g. of a segment, need not have a path
+				return errors.New("-paths can't be used with -bind")
+			}
+			sel, err := newSelector(args[0], *bind)
+			if err != nil {
+				return err
+			}
+			enc, err := newEncoder(e.stdout, *to, *width)
+			if err != nil {
+				return err
+			}
+			return e.eachSexp(args[1:], func(s sexprs.Sexp) error {
+				for _, m := range sel(s) {
+					if *paths {
+						fmt.Fprintf(e.stdout, "%s\t", formatPath(m.Path))
+					}
+					if err := enc.Encode(m.Sexp); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	},
+}
+
+// A selector returns the matches of an expression in an S-expression.
+type selector func(s sexprs.Sexp) []sexprs.Match
+
+// everything selects every subexpression of an S-expression, itself
+// included.
+var everything = sexprs.MustCompileQuery("//*")
+
+// newSelector returns a selector for expr: a path query if it begins
+// with /, and otherwise a pattern, which selects every subexpression
+// matching it.  If bind is not empty, a pattern selects the binding of
+// the variable bind in each match instead, without a path.
+func newSelector(expr, bind string) (selector, error) {
+	if strings.HasPrefix(expr, "/") {
+		if bind != "" {
+			return nil, errors.New("-bind requires a pattern")
+		}
+		q, err := sexprs.CompileQuery(expr)
+		if err != nil {
+			return nil, err
+		}
+		return q.Select, nil
+	}
+	p, err := sexprs.ParsePattern(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(s sexprs.Sexp) []sexprs.Match {
+		var matches []sexprs.Match
+		for _, m := range everything.Select(s) {
+			b, ok := p.Match(m.Sexp)
+			switch {
+			case !ok:
+			case bind == "":
+				matches = append(matches, m)
+			case b[bind] != nil:
+				matches = append(matches, sexprs.Match{Sexp: b[bind]})
+			}
+		}
+		return matches
+	}, nil
+}
+
+// formatPath returns path as its indices separated by slashes, e.g.
+// /2/1, or / for the root.
+func formatPath(path []int) string {
+	if len(path) == 0 {
+		return "/"
+	}
+	var b strings.Builder
+	for _, i := range path {
+		fmt.Fprintf(&b, "/%d", i)
+	}
+	return b.String()
+}
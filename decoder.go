@@ -0,0 +1,115 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// A Decoder reads successive S-expressions from an input stream, in
+// the manner of encoding/json's Decoder.  Whitespace between
+// top-level expressions is skipped.
+type Decoder struct {
+	p  *reader
+	cr *countingReader
+}
+
+// countingReader counts the bytes read from its underlying reader,
+// so that a Decoder can report its offset despite buffering.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewDecoder returns a new Decoder reading from r.  The Decoder
+// introduces its own buffering and may read data from r beyond the
+// S-expressions requested; see Buffered.
+func NewDecoder(r io.Reader) *Decoder {
+	cr := &countingReader{r: r}
+	return &Decoder{p: &reader{r: bufio.NewReader(cr), limits: DefaultLimits}, cr: cr}
+}
+
+// SetLimits sets the limits enforced on each subsequent S-expression
+// read.  By default a Decoder enforces DefaultLimits.
+func (d *Decoder) SetLimits(l Limits) {
+	d.p.limits = l
+}
+
+// Decode reads the next S-expression from its input.  It returns
+// io.EOF only if the input ends between expressions; if it ends in
+// the midst of one, a *SyntaxError of kind io.ErrUnexpectedEOF is
+// returned instead.  The positions of syntax errors are relative to
+// the start of the Decoder's input.
+func (d *Decoder) Decode() (s Sexp, err error) {
+	if err = d.skipWhitespace(); err != nil {
+		return nil, err
+	}
+	d.p.depth, d.p.start = 0, d.p.n
+	s, err = d.p.read()
+	switch {
+	case err == io.EOF && s != nil:
+		// the expression was terminated by the end of input
+		return s, nil
+	case err == io.EOF:
+		return nil, d.p.unexpectedEOF("S-expression")
+	case err != nil:
+		return nil, err
+	}
+	return s, nil
+}
+
+// DecodeValue reads the next S-expression from its input and stores
+// it in the value pointed to by v, as Unmarshal does.
+func (d *Decoder) DecodeValue(v interface{}) error {
+	s, err := d.Decode()
+	if err != nil {
+		return err
+	}
+	return Unmarshal(s, v)
+}
+
+// More reports whether there is another S-expression in the input.
+// Any read error other than io.EOF is left for Decode to report.
+func (d *Decoder) More() bool {
+	return d.skipWhitespace() != io.EOF
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's
+// buffer.  The reader is valid until the next call to Decode.
+func (d *Decoder) Buffered() io.Reader {
+	b, _ := d.p.r.Peek(d.p.r.Buffered())
+	return bytes.NewReader(b)
+}
+
+// InputOffset returns the offset in bytes of the current Decoder
+// position, i.e. the number of input bytes consumed by previous calls
+// to Decode.  Reading the rest of the input from Buffered followed by
+// the original reader resumes exactly at this offset.
+func (d *Decoder) InputOffset() int64 {
+	return d.cr.n - int64(d.p.r.Buffered())
+}
+
+// skipWhitespace consumes whitespace up to the next byte of an
+// S-expression, returning io.EOF if there is none.
+func (d *Decoder) skipWhitespace() error {
+	for {
+		c, err := d.p.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		d.p.consumed(c)
+		if bytes.IndexByte(whitespaceChar, c) == -1 {
+			return d.p.unreadByte()
+		}
+	}
+}
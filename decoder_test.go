@@ -0,0 +1,91 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDecoder(t *testing.T) {
+	d := NewDecoder(strings.NewReader(" (a b)\n3:foo  bar\t[hint]baz (c)\n"))
+	expected := []Sexp{
+		List{Atom{Value: []byte("a")}, Atom{Value: []byte("b")}},
+		Atom{Value: []byte("foo")},
+		Atom{Value: []byte("bar")},
+		Atom{DisplayHint: []byte("hint"), Value: []byte("baz")},
+		List{Atom{Value: []byte("c")}},
+	}
+	for i, e := range expected {
+		if !d.More() {
+			t.Fatalf("expression %d: More returned false", i)
+		}
+		s, err := d.Decode()
+		if err != nil {
+			t.Fatalf("expression %d: %v", i, err)
+		}
+		if !s.Equal(e) {
+			t.Fatalf("expression %d: expected %v; got %v", i, e, s)
+		}
+	}
+	if d.More() {
+		t.Fatal("More returned true at end of input")
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF; got %v", err)
+	}
+}
+
+func TestDecoderTokenAtEOF(t *testing.T) {
+	d := NewDecoder(strings.NewReader("testing"))
+	s, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Equal(Atom{Value: []byte("testing")}) {
+		t.Fatal("Bad ", s)
+	}
+	if _, err = d.Decode(); err != io.EOF {
+		t.Fatalf("expected io.EOF; got %v", err)
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	for _, input := range []string{"(a b", "7:foobar", "[hint", "(a (b c)"} {
+		d := NewDecoder(strings.NewReader(input))
+		if _, err := d.Decode(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("%q: expected io.ErrUnexpectedEOF; got %v", input, err)
+		}
+	}
+}
+
+func TestDecoderHandOff(t *testing.T) {
+	input := "(3:foo)(bar) rest of stream"
+	r := strings.NewReader(input)
+	d := NewDecoder(r)
+	if _, err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if d.InputOffset() != 7 {
+		t.Fatalf("expected offset 7; got %d", d.InputOffset())
+	}
+	if _, err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if d.InputOffset() != 12 {
+		t.Fatalf("expected offset 12; got %d", d.InputOffset())
+	}
+	rest, err := ioutil.ReadAll(io.MultiReader(d.Buffered(), r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte(" rest of stream")) {
+		t.Fatalf("bad remainder %q", rest)
+	}
+}
@@ -0,0 +1,418 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// An EditOp is the kind of change made by an Edit.
+type EditOp int
+
+const (
+	// EditInsert inserts New into a list, so that it is at Path.
+	EditInsert EditOp = iota
+	// EditDelete removes Old from Path.
+	EditDelete
+	// EditReplace replaces Old at Path with New.
+	EditReplace
+	// EditHint replaces the atom Old at Path with New, which differs
+	// from it only in its display hint.
+	EditHint
+)
+
+var editOpNames = []string{"insert", "delete", "replace", "hint"}
+
+func (op EditOp) String() string {
+	if op < 0 || int(op) >= len(editOpNames) {
+		return "EditOp(" + strconv.Itoa(int(op)) + ")"
+	}
+	return editOpNames[op]
+}
+
+// An Edit is a single change to an S-expression.  Its path addresses
+// an element as MerkleTree does: the indices of the successive lists
+// containing it, starting from the root.  Old, if not nil, is checked
+// against the S-expression being edited when the edit is applied.
+type Edit struct {
+	Op   EditOp
+	Path []int
+	Old  Sexp // for EditDelete, EditReplace and EditHint
+	New  Sexp // for EditInsert, EditReplace and EditHint
+}
+
+// A Patch is a sequence of edits, each applying to the result of those
+// before it.  Its S-expression form lists each edit by its Op, e.g.:
+//    (patch
+//      (replace (path "1" "2") (old alice) (new bob))
+//      (insert (path "3") (new (comment hi)))
+//      (delete (path "4") (old (tag (*))))
+//      (hint (path "5" "1") (old "x") (new [text/plain]"x")))
+// Indices are decimal atoms.
+type Patch []Edit
+
+// Diff returns a patch which turns a into b.  The elements of lists are
+// aligned so as to need the fewest edits, preferring to pair atoms with
+// atoms and lists with lists of the same head; paired lists are diffed
+// in turn.  Atoms differing only in their display hints yield an
+// EditHint.  Either of a and b may be nil, meaning that it is absent:
+// the patch then inserts or deletes the root.
+//
+// Aligning lists takes time and memory in proportion to their lengths
+// plus (m+1)×(n+1), where m and n are the numbers of elements of each
+// left once any common prefix and suffix are set aside.  Where that
+// product exceeds 2^20, elements are instead paired by position, so
+// that the patch, though correct, may not be the smallest.
+func Diff(a, b Sexp) Patch {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		return Patch{{Op: EditInsert, Path: []int{}, New: b}}
+	case b == nil:
+		return Patch{{Op: EditDelete, Path: []int{}, Old: a}}
+	}
+	return diff(nil, a, b, []int{})
+}
+
+// maxAlignment is the greatest number of entries in the table of costs
+// which align computes.
+const maxAlignment = 1 << 20
+
+// equal reports whether a and b are equal, either of which may be nil.
+func equal(a, b Sexp) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(b)
+}
+
+func diff(p Patch, a, b Sexp, path []int) Patch {
+	if equal(a, b) {
+		return p
+	}
+	switch a := a.(type) {
+	case List:
+		if b, ok := b.(List); ok {
+			return diffLists(p, a, b, path)
+		}
+	case Atom:
+		if b, ok := b.(Atom); ok && bytes.Equal(a.Value, b.Value) {
+			return append(p, Edit{Op: EditHint, Path: path, Old: a, New: b})
+		}
+	}
+	return append(p, Edit{Op: EditReplace, Path: path, Old: a, New: b})
+}
+
+func diffLists(p Patch, a, b List, path []int) Patch {
+	// k is the index in the list as edited so far
+	k := 0
+	for _, pair := range align(a, b) {
+		switch {
+		case pair.i == -1:
+			p = append(p, Edit{Op: EditInsert, Path: appendPath(path, k), New: b[pair.j]})
+			k++
+		case pair.j == -1:
+			p = append(p, Edit{Op: EditDelete, Path: appendPath(path, k), Old: a[pair.i]})
+		case similar(a[pair.i], b[pair.j]):
+			p = diff(p, a[pair.i], b[pair.j], appendPath(path, k))
+			k++
+		default:
+			p = append(p, Edit{Op: EditReplace, Path: appendPath(path, k), Old: a[pair.i], New: b[pair.j]})
+			k++
+		}
+	}
+	return p
+}
+
+// A pairing aligns a[i] with b[j], where a and b are lists; i is -1 if
+// b[j] is inserted, and j is -1 if a[i] is deleted.
+type pairing struct {
+	i, j int
+}
+
+// align returns the alignment of the elements of a and b needing the
+// fewest edits, in order, or, if that would mean computing more than
+// maxAlignment costs, their alignment by position.
+func align(a, b List) []pairing {
+	pairs := make([]pairing, 0, len(a)+len(b))
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && equal(a[prefix], b[prefix]) {
+		pairs = append(pairs, pairing{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && equal(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+	m, n := len(a)-suffix, len(b)-suffix
+	if int64(m-prefix+1)*int64(n-prefix+1) > maxAlignment {
+		i, j := prefix, prefix
+		for ; i < m && j < n; i, j = i+1, j+1 {
+			pairs = append(pairs, pairing{i, j})
+		}
+		for ; i < m; i++ {
+			pairs = append(pairs, pairing{i, -1})
+		}
+		for ; j < n; j++ {
+			pairs = append(pairs, pairing{-1, j})
+		}
+		for ; i < len(a); i, j = i+1, j+1 {
+			pairs = append(pairs, pairing{i, j})
+		}
+		return pairs
+	}
+	// cost[i][j] is the number of edits needed to turn a[prefix+i:m]
+	// into b[prefix+j:n], counting the replacement of an element by a
+	// dissimilar one as a deletion and an insertion, so that similar
+	// elements are preferably paired
+	x, y := a[prefix:m], b[prefix:n]
+	cost := make([][]int, len(x)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(y)+1)
+		cost[i][len(y)] = len(x) - i
+	}
+	for j := range y {
+		cost[len(x)][j] = len(y) - j
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			cost[i][j] = minInt(cost[i+1][j]+1, cost[i][j+1]+1, cost[i+1][j+1]+pairCost(x[i], y[j]))
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && cost[i][j] == cost[i+1][j+1]+pairCost(x[i], y[j]):
+			pairs = append(pairs, pairing{prefix + i, prefix + j})
+			i, j = i+1, j+1
+		case i < len(x) && cost[i][j] == cost[i+1][j]+1:
+			pairs = append(pairs, pairing{prefix + i, -1})
+			i++
+		default:
+			pairs = append(pairs, pairing{-1, prefix + j})
+			j++
+		}
+	}
+	for i, j = m, n; i < len(a); i, j = i+1, j+1 {
+		pairs = append(pairs, pairing{i, j})
+	}
+	return pairs
+}
+
+// pairCost is the cost of turning a into b, where each is an element
+// of a list.
+func pairCost(a, b Sexp) int {
+	switch {
+	case equal(a, b):
+		return 0
+	case similar(a, b):
+		return 1
+	}
+	return 2
+}
+
+// similar reports whether a and b are both atoms, or both lists with
+// the same head, so that b is best regarded as a modification of a.
+func similar(a, b Sexp) bool {
+	_, aIsList := a.(List)
+	_, bIsList := b.(List)
+	if !aIsList || !bIsList {
+		return aIsList == bIsList
+	}
+	ah, aOK := head(a)
+	bh, bOK := head(b)
+	return aOK == bOK && bytes.Equal(ah, bh)
+}
+
+func minInt(n int, ns ...int) int {
+	for _, m := range ns {
+		if m < n {
+			n = m
+		}
+	}
+	return n
+}
+
+// Apply returns the result of applying p to s.  s itself is not
+// modified.  s may be nil, if p inserts the root, and the result is
+// nil if p deletes it.
+func (p Patch) Apply(s Sexp) (Sexp, error) {
+	for i, e := range p {
+		var err error
+		if s, err = e.apply(s, e.Path); err != nil {
+			return nil, errors.Wrapf(err, "edit %d: %s %v", i, e.Op, e.Path)
+		}
+	}
+	return s, nil
+}
+
+// apply returns s with e applied at path, relative to s.
+func (e Edit) apply(s Sexp, path []int) (Sexp, error) {
+	if len(path) == 0 {
+		switch e.Op {
+		case EditInsert:
+			// only an absent S-expression may be inserted
+			switch {
+			case s != nil:
+				return nil, errors.Errorf("can't insert at the root of %s", s)
+			case e.New == nil:
+				return nil, errors.New("nothing to insert")
+			}
+			return e.New, nil
+		case EditDelete:
+			if e.Old != nil && !e.Old.Equal(s) {
+				return nil, errors.Errorf("expected %s; found %s", e.Old, s)
+			}
+			return nil, nil
+		}
+		return e.replace(s)
+	}
+	l, ok := s.(List)
+	if !ok {
+		return nil, errors.Errorf("%s is not a list", s)
+	}
+	i, last := path[0], len(path) == 1
+	max := len(l) - 1
+	if last && e.Op == EditInsert {
+		max = len(l)
+	}
+	if i < 0 || i > max {
+		return nil, errors.Errorf("index %d out of range", i)
+	}
+	switch {
+	case last && e.Op == EditInsert:
+		if e.New == nil {
+			return nil, errors.New("nothing to insert")
+		}
+		result := make(List, 0, len(l)+1)
+		result = append(append(append(result, l[:i]...), e.New), l[i:]...)
+		return result, nil
+	case last && e.Op == EditDelete:
+		if e.Old != nil && !e.Old.Equal(l[i]) {
+			return nil, errors.Errorf("expected %s; found %s", e.Old, l[i])
+		}
+		return append(append(make(List, 0, len(l)-1), l[:i]...), l[i+1:]...), nil
+	}
+	element, err := e.apply(l[i], path[1:])
+	if err != nil {
+		return nil, err
+	}
+	result := append(List{}, l...)
+	result[i] = element
+	return result, nil
+}
+
+// replace returns the replacement of s by an EditReplace or EditHint.
+func (e Edit) replace(s Sexp) (Sexp, error) {
+	switch {
+	case e.Op != EditReplace && e.Op != EditHint:
+		return nil, errors.Errorf("unknown edit %s", e.Op)
+	case e.New == nil:
+		return nil, errors.New("no replacement")
+	case e.Old != nil && !e.Old.Equal(s):
+		return nil, errors.Errorf("expected %s; found %s", e.Old, s)
+	}
+	if e.Op == EditHint {
+		a, ok := s.(Atom)
+		b, isAtom := e.New.(Atom)
+		if !ok || !isAtom || !bytes.Equal(a.Value, b.Value) {
+			return nil, errors.Errorf("%s is not %s with a different display hint", e.New, s)
+		}
+	}
+	return e.New, nil
+}
+
+// MarshalSexp implements Marshaler.
+func (p Patch) MarshalSexp() (Sexp, error) {
+	l := List{Atom{Value: []byte("patch")}}
+	for _, e := range p {
+		if e.Op < 0 || int(e.Op) >= len(editOpNames) {
+			return nil, errors.Errorf("unknown edit %s", e.Op)
+		}
+		path := List{Atom{Value: []byte("path")}}
+		for _, i := range e.Path {
+			path = append(path, Atom{Value: []byte(strconv.Itoa(i))})
+		}
+		edit := List{Atom{Value: []byte(e.Op.String())}, path}
+		if e.Old != nil {
+			edit = append(edit, List{Atom{Value: []byte("old")}, e.Old})
+		}
+		if e.New != nil {
+			edit = append(edit, List{Atom{Value: []byte("new")}, e.New})
+		}
+		l = append(l, edit)
+	}
+	return l, nil
+}
+
+// UnmarshalSexp implements Unmarshaler.
+func (p *Patch) UnmarshalSexp(s Sexp) error {
+	if h, ok := head(s); !ok || string(h) != "patch" {
+		return errors.Errorf("expected (patch ...); got %s", s)
+	}
+	var patch Patch
+	for _, element := range s.(List)[1:] {
+		e, err := unmarshalEdit(element)
+		if err != nil {
+			return errors.Wrapf(err, "edit %d", len(patch))
+		}
+		patch = append(patch, e)
+	}
+	*p = patch
+	return nil
+}
+
+func unmarshalEdit(s Sexp) (Edit, error) {
+	var e Edit
+	h, ok := head(s)
+	if !ok {
+		return e, errors.Errorf("expected edit; got %s", s)
+	}
+	for e.Op = 0; int(e.Op) < len(editOpNames) && editOpNames[e.Op] != string(h); e.Op++ {
+	}
+	if int(e.Op) == len(editOpNames) {
+		return e, errors.Errorf("unknown edit %s", h)
+	}
+	l := s.(List)
+	if h, ok := head(listElement(l, 1)); !ok || string(h) != "path" {
+		return e, errors.Errorf("expected (path ...); got %s", listElement(l, 1))
+	}
+	e.Path = []int{}
+	for _, index := range l[1].(List)[1:] {
+		a, ok := index.(Atom)
+		i, err := strconv.Atoi(string(a.Value))
+		if !ok || err != nil || i < 0 {
+			return e, errors.Errorf("bad index %s", index)
+		}
+		e.Path = append(e.Path, i)
+	}
+	for _, field := range l[2:] {
+		h, ok := head(field)
+		if !ok || len(field.(List)) != 2 {
+			return e, errors.Errorf("expected (old ...) or (new ...); got %s", field)
+		}
+		switch string(h) {
+		case "old":
+			e.Old = field.(List)[1]
+		case "new":
+			e.New = field.(List)[1]
+		default:
+			return e, errors.Errorf("unknown field %s", h)
+		}
+	}
+	return e, nil
+}
+
+// listElement returns l[i], or nil if l is too short.
+func listElement(l List, i int) Sexp {
+	if i >= len(l) {
+		return nil
+	}
+	return l[i]
+}
@@ -0,0 +1,241 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	for _, test := range []struct {
+		a, b  string
+		edits int
+	}{
+		{"a", "a", 0},
+		{"a", "b", 1},
+		{"a", "[text]a", 1},
+		{"a", "(a)", 1},
+		{"(a b c)", "(a b c)", 0},
+		{"(a b c)", "(a c)", 1},
+		{"(a b c)", "(a b c d)", 1},
+		{"(a b c)", "(z a b c)", 1},
+		{"(a b c)", "(a x c)", 1},
+		{"(a b c)", "(c b a)", 2},
+		{"(a b c)", "()", 3},
+		{"()", "(a b c)", 3},
+		{"(a (b (c d)) e)", "(a (b (c x)) e)", 1},
+		{"(a (b c) (d e) f)", "(a (d e) (b c) f)", 2},
+		{"(cert (issuer alice) (subject bob) (tag (*)))", "(cert (issuer carol) (subject bob) (comment hi) (tag (ftp)))", 3},
+		{"(a b c d e f)", "(x b y d z f w)", 4},
+		{"(a [text]b c)", "(a b c d)", 2},
+	} {
+		a, b := parseString(t, test.a), parseString(t, test.b)
+		p := Diff(a, b)
+		if len(p) != test.edits {
+			t.Errorf("%s -> %s: expected %d edits; got %d: %v", test.a, test.b, test.edits, len(p), patchString(t, p))
+		}
+		result, err := p.Apply(a)
+		if err != nil {
+			t.Errorf("%s -> %s: %v", test.a, test.b, err)
+			continue
+		}
+		if !result.Equal(b) || !bytes.Equal(result.Pack(), b.Pack()) {
+			t.Errorf("%s -> %s: got %s", test.a, test.b, result)
+		}
+		if !a.Equal(parseString(t, test.a)) {
+			t.Errorf("%s -> %s: Apply modified its argument", test.a, test.b)
+		}
+		// the patch survives conversion to an S-expression and back
+		var q Patch
+		if err = q.UnmarshalSexp(parseString(t, patchString(t, p))); err != nil {
+			t.Errorf("%s -> %s: %v", test.a, test.b, err)
+			continue
+		}
+		if result, err = q.Apply(a); err != nil || !result.Equal(b) {
+			t.Errorf("%s -> %s: unmarshalled patch gave %v, %v", test.a, test.b, result, err)
+		}
+	}
+}
+
+func TestDiffAbsent(t *testing.T) {
+	a := parseString(t, "(a b)")
+	for _, test := range []struct {
+		a, b Sexp
+	}{
+		{nil, nil},
+		{nil, a},
+		{a, nil},
+	} {
+		p := Diff(test.a, test.b)
+		result, err := p.Apply(test.a)
+		if err != nil {
+			t.Errorf("%v -> %v: %v", test.a, test.b, err)
+			continue
+		}
+		if !equal(result, test.b) {
+			t.Errorf("%v -> %v: got %v", test.a, test.b, result)
+		}
+	}
+	if p := Diff(nil, nil); len(p) != 0 {
+		t.Errorf("expected no edits; got %v", p)
+	}
+}
+
+func TestDiffLarge(t *testing.T) {
+	// too long to align, so paired by position
+	var a, b List
+	for i := 0; i < 2000; i++ {
+		a = append(a, Atom{Value: []byte(fmt.Sprintf("a%d", i))})
+		b = append(b, Atom{Value: []byte(fmt.Sprintf("b%d", i))})
+	}
+	b = append(b, Atom{Value: []byte("c")})
+	p := Diff(a, b)
+	if len(p) != len(b) {
+		t.Errorf("expected %d edits; got %d", len(b), len(p))
+	}
+	result, err := p.Apply(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Equal(b) {
+		t.Errorf("got %s", result)
+	}
+}
+
+func TestDiffLongPrefix(t *testing.T) {
+	// only the differing elements should be aligned
+	var a, b List
+	for i := 0; i < 200000; i++ {
+		a = append(a, Atom{Value: []byte(fmt.Sprintf("%d", i))})
+		if i < 199800 {
+			b = append(b, a[i])
+		} else {
+			b = append(b, Atom{Value: []byte(fmt.Sprintf("b%d", i))})
+		}
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	p := Diff(a, b)
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 32<<20 {
+		t.Errorf("allocated %d bytes", n)
+	}
+	if len(p) != 200 {
+		t.Errorf("expected 200 edits; got %d", len(p))
+	}
+	result, err := p.Apply(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Equal(b) {
+		t.Error("patch did not produce b")
+	}
+}
+
+func TestAlignBound(t *testing.T) {
+	// the table of costs must stay within maxAlignment entries however
+	// long the lists, and whatever their common prefix and suffix
+	for _, test := range []struct {
+		common, m, n int
+	}{
+		{0, 1023, 1023},
+		{0, 1024, 1024},
+		{100000, 1023, 1023},
+		{100000, 1024, 1024},
+		{0, 0, 2000000},
+		{0, 1, 600000},
+	} {
+		var a, b List
+		for i := 0; i < test.common; i++ {
+			a = append(a, Atom{Value: []byte(fmt.Sprintf("%d", i))})
+			b = append(b, a[i])
+		}
+		for i := 0; i < test.m; i++ {
+			a = append(a, Atom{Value: []byte(fmt.Sprintf("a%d", i))})
+		}
+		for i := 0; i < test.n; i++ {
+			b = append(b, Atom{Value: []byte(fmt.Sprintf("b%d", i))})
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		pairs := align(a, b)
+		runtime.ReadMemStats(&after)
+		// the table and the pairs
+		max := uint64(8*maxAlignment + 16*(len(a)+len(b)) + 1<<20)
+		if n := after.TotalAlloc - before.TotalAlloc; n > max {
+			t.Errorf("%d+%d×%d: allocated %d bytes", test.common, test.m, test.n, n)
+		}
+		if len(pairs) < len(a) || len(pairs) < len(b) {
+			t.Errorf("%d+%d×%d: only %d pairs", test.common, test.m, test.n, len(pairs))
+		}
+	}
+}
+
+func patchString(t *testing.T, p Patch) string {
+	s, err := p.MarshalSexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.String()
+}
+
+func TestPatchApplyErrors(t *testing.T) {
+	s := parseString(t, "(a (b c) d)")
+	for _, edit := range []Edit{
+		{Op: EditInsert, Path: []int{}, New: s},
+		{Op: EditDelete, Path: []int{}, Old: parseString(t, "e")},
+		{Op: EditDelete, Path: []int{3}},
+		{Op: EditInsert, Path: []int{4}, New: s},
+		{Op: EditInsert, Path: []int{1}},
+		{Op: EditDelete, Path: []int{0, 1}},
+		{Op: EditDelete, Path: []int{-1}},
+		{Op: EditDelete, Path: []int{2}, Old: parseString(t, "e")},
+		{Op: EditReplace, Path: []int{1, 1}, Old: parseString(t, "x"), New: parseString(t, "y")},
+		{Op: EditReplace, Path: []int{1, 1}},
+		{Op: EditHint, Path: []int{1, 1}, New: parseString(t, "[text]x")},
+		{Op: EditHint, Path: []int{1}, New: parseString(t, "[text]x")},
+		{Op: EditOp(9), Path: []int{1}, New: s},
+	} {
+		if result, err := (Patch{edit}).Apply(s); err == nil {
+			t.Errorf("%s %v: expected error; got %s", edit.Op, edit.Path, result)
+		}
+	}
+}
+
+func TestPatchUnmarshalErrors(t *testing.T) {
+	for _, patch := range []string{
+		"foo",
+		"(diff)",
+		"(patch foo)",
+		"(patch (move (path)))",
+		"(patch (insert))",
+		"(patch (insert (route)))",
+		`(patch (insert (path "-1") (new a)))`,
+		"(patch (insert (path x) (new a)))",
+		"(patch (insert (path) (new)))",
+		"(patch (insert (path) (newer a)))",
+	} {
+		var p Patch
+		if err := p.UnmarshalSexp(parseString(t, patch)); err == nil {
+			t.Errorf("%s: expected error", patch)
+		}
+	}
+}
+
+func ExampleDiff() {
+	a, _, _ := Parse([]byte("(cert (issuer alice) (subject bob) (tag (*)))"))
+	b, _, _ := Parse([]byte("(cert (issuer carol) (subject bob) (comment hi) (tag (*)))"))
+	p := Diff(a, b)
+	s, _ := p.MarshalSexp()
+	fmt.Println(s.String())
+	result, _ := p.Apply(a)
+	fmt.Println(result.Equal(b))
+	// Output:
+	// (patch (replace (path "1" "1") (old alice) (new carol)) (insert (path "3") (new (comment hi))))
+	// true
+}
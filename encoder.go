@@ -0,0 +1,161 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// A Representation is one of the ways in which an S-expression may be
+// written.
+type Representation int
+
+const (
+	// Canonical is the packed representation returned by Pack.
+	Canonical Representation = iota
+	// Advanced is the legible representation returned by String.
+	Advanced
+	// Transport is the base64-encoded canonical representation,
+	// within braces, returned by Base64String.
+	Transport
+)
+
+func (r Representation) String() string {
+	switch r {
+	case Canonical:
+		return "canonical"
+	case Advanced:
+		return "advanced"
+	case Transport:
+		return "transport"
+	default:
+		return "Representation(" + strconv.Itoa(int(r)) + ")"
+	}
+}
+
+// An Encoder writes S-expressions to an output stream.  Unlike Pack
+// and String, it does not build the whole representation in memory
+// before writing it.
+type Encoder struct {
+	w       io.Writer
+	rep     Representation
+	printer *Printer
+}
+
+// NewEncoder returns a new Encoder writing the canonical representation
+// to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, rep: Canonical}
+}
+
+// SetRepresentation sets the representation used by subsequent calls
+// to Encode.
+func (e *Encoder) SetRepresentation(r Representation) {
+	e.rep = r
+}
+
+// SetPrinter sets the Printer used to lay out the advanced
+// representation.  If p is nil, as it is by default, each advanced
+// expression is written on a single line.
+func (e *Encoder) SetPrinter(p *Printer) {
+	e.printer = p
+}
+
+// Encode writes s to the stream in the Encoder's representation,
+// returning the first write error encountered.  Canonical expressions
+// are written back-to-back, as they are self-delimiting; advanced and
+// transport expressions are each followed by a newline.
+func (e *Encoder) Encode(s Sexp) error {
+	if s == nil {
+		return errors.New("can't encode nil S-expression")
+	}
+	w := bufio.NewWriter(e.w)
+	switch e.rep {
+	case Canonical:
+		writeCanonical(w, s)
+	case Advanced:
+		if e.printer != nil {
+			e.printer.print(w, s, 0, 0)
+		} else {
+			writeAdvanced(w, s)
+		}
+		w.WriteByte('\n')
+	case Transport:
+		w.WriteByte('{')
+		enc := base64.NewEncoder(base64Encoding, w)
+		writeCanonical(enc, s)
+		enc.Close()
+		w.WriteString("}\n")
+	default:
+		return errors.Errorf("unknown representation %v", e.rep)
+	}
+	return w.Flush()
+}
+
+// writeCanonical streams the canonical representation of s to w.  Write
+// errors are not returned: w is expected to record them, as
+// bufio.Writer does.
+func writeCanonical(w io.Writer, s Sexp) {
+	switch s := s.(type) {
+	case Atom:
+		var scratch [24]byte
+		if len(s.DisplayHint) > 0 {
+			b := append(scratch[:0], '[')
+			b = strconv.AppendInt(b, int64(len(s.DisplayHint)), 10)
+			w.Write(append(b, ':'))
+			w.Write(s.DisplayHint)
+			w.Write([]byte{']'})
+		}
+		b := strconv.AppendInt(scratch[:0], int64(len(s.Value)), 10)
+		w.Write(append(b, ':'))
+		w.Write(s.Value)
+	case List:
+		w.Write([]byte{'('})
+		for _, datum := range s {
+			writeCanonical(w, datum)
+		}
+		w.Write([]byte{')'})
+	default:
+		buf := bytes.NewBuffer(nil)
+		s.PackBuffer(buf)
+		w.Write(buf.Bytes())
+	}
+}
+
+// writeAdvanced streams the advanced representation of s to w, with
+// no line breaks.  Only individual atoms are buffered.
+func writeAdvanced(w io.Writer, s Sexp) {
+	switch s := s.(type) {
+	case List:
+		w.Write([]byte{'('})
+		for i, datum := range s {
+			if i > 0 {
+				w.Write([]byte{' '})
+			}
+			writeAdvanced(w, datum)
+		}
+		w.Write([]byte{')'})
+	default:
+		buf := bytes.NewBuffer(nil)
+		s.StringBuffer(buf)
+		w.Write(buf.Bytes())
+	}
+}
+
+// EncodeValue writes the S-expression encoding of v, as returned by
+// Marshal, to the stream.
+func (e *Encoder) EncodeValue(v interface{}) error {
+	s, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.Encode(s)
+}
@@ -0,0 +1,68 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var encoderTestSexp = List{
+	Atom{Value: []byte("foo")},
+	Atom{Value: []byte("bar")},
+	Atom{DisplayHint: []byte("bin"), Value: []byte("baz quux")},
+}
+
+func TestEncoder(t *testing.T) {
+	for _, test := range []struct {
+		rep      Representation
+		expected string
+	}{
+		{Canonical, "(3:foo3:bar[3:bin]8:baz quux)(3:foo3:bar[3:bin]8:baz quux)"},
+		{Advanced, "(foo bar [bin]\"baz quux\")\n(foo bar [bin]\"baz quux\")\n"},
+		{Transport, "{KDM6Zm9vMzpiYXJbMzpiaW5dODpiYXogcXV1eCk=}\n{KDM6Zm9vMzpiYXJbMzpiaW5dODpiYXogcXV1eCk=}\n"},
+	} {
+		buf := bytes.NewBuffer(nil)
+		e := NewEncoder(buf)
+		e.SetRepresentation(test.rep)
+		for i := 0; i < 2; i++ {
+			if err := e.Encode(encoderTestSexp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if buf.String() != test.expected {
+			t.Errorf("%v: expected %q; got %q", test.rep, test.expected, buf.String())
+		}
+		d := NewDecoder(buf)
+		for i := 0; i < 2; i++ {
+			s, err := d.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !s.Equal(encoderTestSexp) {
+				t.Errorf("%v: round trip produced %v", test.rep, s)
+			}
+		}
+	}
+}
+
+type failingWriter struct{}
+
+var errFailingWriter = errors.New("write failed")
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errFailingWriter
+}
+
+func TestEncoderWriteError(t *testing.T) {
+	for _, rep := range []Representation{Canonical, Advanced, Transport} {
+		e := NewEncoder(failingWriter{})
+		e.SetRepresentation(rep)
+		if err := e.Encode(encoderTestSexp); err != errFailingWriter {
+			t.Errorf("%v: expected write error; got %v", rep, err)
+		}
+	}
+}
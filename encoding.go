@@ -0,0 +1,232 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// This file implements the standard library's encoding interfaces on
+// Atom and List: encoding.TextMarshaler and TextUnmarshaler use the
+// advanced representation; encoding.BinaryMarshaler and
+// BinaryUnmarshaler, database/sql.Scanner and driver.Valuer (List
+// only; see NullSexp) use the canonical representation; and
+// fmt.Formatter understands the following verbs:
+//
+//    %v   the advanced representation
+//    %s   the advanced representation
+//    %q   the advanced representation, as a double-quoted Go string
+//    %x   the canonical representation, in lower-case hexadecimal
+//    %X   the canonical representation, in upper-case hexadecimal
+//    %+v  the transport representation
+//    %#v  the canonical representation
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Atom) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.  text must
+// contain exactly one atom, in any representation.
+func (a *Atom) UnmarshalText(text []byte) error {
+	s, err := parseOnly(text)
+	if err != nil {
+		return err
+	}
+	return a.set(s)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (a Atom) MarshalBinary() ([]byte, error) {
+	return a.Pack(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  data must
+// contain exactly one atom, in canonical representation.
+func (a *Atom) UnmarshalBinary(data []byte) error {
+	s, err := ParseCanonical(data)
+	if err != nil {
+		return err
+	}
+	return a.set(s)
+}
+
+// Format implements fmt.Formatter.
+func (a Atom) Format(f fmt.State, verb rune) {
+	format(f, verb, a)
+}
+
+// Scan implements database/sql.Scanner.  A NULL value is scanned as
+// the empty Atom.
+func (a *Atom) Scan(src interface{}) error {
+	if src == nil {
+		*a = Atom{}
+		return nil
+	}
+	s, err := scan(src)
+	if err != nil {
+		return err
+	}
+	return a.set(s)
+}
+
+func (a *Atom) set(s Sexp) error {
+	atom, ok := s.(Atom)
+	if !ok {
+		return errors.Errorf("expected atom; got %s", s)
+	}
+	*a = atom
+	return nil
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (l List) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.  text must
+// contain exactly one list, in any representation.
+func (l *List) UnmarshalText(text []byte) error {
+	s, err := parseOnly(text)
+	if err != nil {
+		return err
+	}
+	return l.set(s)
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (l List) MarshalBinary() ([]byte, error) {
+	return l.Pack(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.  data must
+// contain exactly one list, in canonical representation.
+func (l *List) UnmarshalBinary(data []byte) error {
+	s, err := ParseCanonical(data)
+	if err != nil {
+		return err
+	}
+	return l.set(s)
+}
+
+// Format implements fmt.Formatter.
+func (l List) Format(f fmt.State, verb rune) {
+	format(f, verb, l)
+}
+
+// Scan implements database/sql.Scanner.  A NULL value is scanned as a
+// nil List.
+func (l *List) Scan(src interface{}) error {
+	if src == nil {
+		*l = nil
+		return nil
+	}
+	s, err := scan(src)
+	if err != nil {
+		return err
+	}
+	return l.set(s)
+}
+
+// Value implements database/sql/driver.Valuer.
+func (l List) Value() (driver.Value, error) {
+	return l.Pack(), nil
+}
+
+func (l *List) set(s Sexp) error {
+	list, ok := s.(List)
+	if !ok {
+		return errors.Errorf("expected list; got %s", s)
+	}
+	*l = list
+	return nil
+}
+
+// NullSexp is an S-expression which may be NULL in a database.  It
+// implements database/sql.Scanner and driver.Valuer for any Sexp,
+// including Atoms: as Atom has a Value field, it cannot itself have
+// the Value method which driver.Valuer requires.
+type NullSexp struct {
+	Sexp  Sexp
+	Valid bool // Valid is true if Sexp is not NULL
+}
+
+// Scan implements database/sql.Scanner.
+func (n *NullSexp) Scan(src interface{}) (err error) {
+	if src == nil {
+		n.Sexp, n.Valid = nil, false
+		return nil
+	}
+	if n.Sexp, err = scan(src); err != nil {
+		n.Valid = false
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements database/sql/driver.Valuer.
+func (n NullSexp) Value() (driver.Value, error) {
+	if !n.Valid || n.Sexp == nil {
+		return nil, nil
+	}
+	return n.Sexp.Pack(), nil
+}
+
+// parseOnly parses the single S-expression in b, which may be
+// surrounded by whitespace but nothing else.
+func parseOnly(b []byte) (Sexp, error) {
+	s, rest, err := Parse(bytes.TrimLeft(b, string(whitespaceChar)))
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New("no S-expression found")
+	}
+	if len(bytes.TrimLeft(rest, string(whitespaceChar))) > 0 {
+		return nil, errors.Errorf("unexpected data after S-expression: %q", rest)
+	}
+	return s, nil
+}
+
+func scan(src interface{}) (Sexp, error) {
+	switch src := src.(type) {
+	case []byte:
+		return ParseCanonical(src)
+	case string:
+		return ParseCanonical([]byte(src))
+	default:
+		return nil, errors.Errorf("can't scan %T into S-expression", src)
+	}
+}
+
+func format(f fmt.State, verb rune, s Sexp) {
+	switch verb {
+	case 'v':
+		switch {
+		case f.Flag('+'):
+			io.WriteString(f, s.Base64String())
+		case f.Flag('#'):
+			f.Write(s.Pack())
+		default:
+			io.WriteString(f, s.String())
+		}
+	case 's':
+		io.WriteString(f, s.String())
+	case 'q':
+		fmt.Fprintf(f, "%q", s.String())
+	case 'x':
+		fmt.Fprintf(f, "%x", s.Pack())
+	case 'X':
+		fmt.Fprintf(f, "%X", s.Pack())
+	default:
+		fmt.Fprintf(f, "%%!%c(%s)", verb, s.String())
+	}
+}
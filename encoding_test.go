@@ -0,0 +1,133 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"flag"
+	"fmt"
+	"testing"
+)
+
+var (
+	_ encoding.TextMarshaler     = Atom{}
+	_ encoding.TextUnmarshaler   = &Atom{}
+	_ encoding.BinaryMarshaler   = Atom{}
+	_ encoding.BinaryUnmarshaler = &Atom{}
+	_ fmt.Formatter              = Atom{}
+	_ sql.Scanner                = &Atom{}
+	_ encoding.TextMarshaler     = List{}
+	_ encoding.TextUnmarshaler   = &List{}
+	_ encoding.BinaryMarshaler   = List{}
+	_ encoding.BinaryUnmarshaler = &List{}
+	_ fmt.Formatter              = List{}
+	_ sql.Scanner                = &List{}
+	_ driver.Valuer              = List{}
+	_ sql.Scanner                = &NullSexp{}
+	_ driver.Valuer              = NullSexp{}
+)
+
+func TestTextAndBinary(t *testing.T) {
+	l := List{Atom{Value: []byte("foo")}, Atom{DisplayHint: []byte("bin"), Value: []byte("baz quux ")}}
+	text, err := l.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(text) != `(foo [bin]"baz quux ")` {
+		t.Fatalf("bad text %q", text)
+	}
+	var l2 List
+	if err = l2.UnmarshalText(append(text, '\n')); err != nil {
+		t.Fatal(err)
+	}
+	if !l2.Equal(l) {
+		t.Fatalf("text round trip produced %s", l2)
+	}
+	bin, err := l[1].(Atom).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var a Atom
+	if err = a.UnmarshalBinary(bin); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Equal(l[1]) {
+		t.Fatalf("binary round trip produced %s", a)
+	}
+	if err = a.UnmarshalBinary([]byte("abc")); err == nil {
+		t.Fatal("unmarshalled advanced representation as binary")
+	}
+	if err = a.UnmarshalText(text); err == nil {
+		t.Fatal("unmarshalled list into atom")
+	}
+	if err = l2.UnmarshalText([]byte("(a) (b)")); err == nil {
+		t.Fatal("unmarshalled trailing data")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	var l List
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.TextVar(&l, "tag", List{}, "authorization tag")
+	if err := fs.Parse([]string{"-tag", "(ftp (* prefix /pub/))"}); err != nil {
+		t.Fatal(err)
+	}
+	if l.String() != "(ftp (* prefix /pub/))" {
+		t.Fatalf("bad flag value %s", l)
+	}
+}
+
+func TestScanAndValue(t *testing.T) {
+	l := List{Atom{Value: []byte("a")}}
+	v, err := l.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var l2 List
+	if err = l2.Scan(v); err != nil {
+		t.Fatal(err)
+	}
+	if !l2.Equal(l) {
+		t.Fatalf("scanned %s", l2)
+	}
+	var a Atom
+	if err = a.Scan("3:abc"); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Scan("abc"); err == nil {
+		t.Fatal("scanned advanced representation")
+	}
+	if err = a.Scan(42); err == nil {
+		t.Fatal("scanned integer")
+	}
+	n := NullSexp{Sexp: a, Valid: true}
+	if v, err = n.Value(); err != nil || !bytes.Equal(v.([]byte), []byte("3:abc")) {
+		t.Fatalf("bad value %v, %v", v, err)
+	}
+	if err = n.Scan(nil); err != nil || n.Valid {
+		t.Fatalf("bad NULL scan %v, %v", n, err)
+	}
+	if v, err = n.Value(); err != nil || v != nil {
+		t.Fatalf("bad NULL value %v, %v", v, err)
+	}
+}
+
+func ExampleList_Format() {
+	l := List{Atom{Value: []byte("foo")}, Atom{DisplayHint: []byte("bin"), Value: []byte("baz quux")}}
+	fmt.Printf("%v\n", l)
+	fmt.Printf("%#v\n", l)
+	fmt.Printf("%q\n", l)
+	fmt.Printf("%x\n", Atom{Value: []byte("a")})
+	fmt.Printf("%+v\n", l)
+	// Output:
+	// (foo [bin]"baz quux")
+	// (3:foo[3:bin]8:baz quux)
+	// "(foo [bin]\"baz quux\")"
+	// 313a61
+	// {KDM6Zm9vWzM6YmluXTg6YmF6IHF1dXgp}
+}
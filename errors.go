@@ -0,0 +1,67 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// The kinds of syntax error, reported by errors.Is for a *SyntaxError.
+// A syntax error caused by input ending in the midst of an
+// S-expression is of kind io.ErrUnexpectedEOF.
+var (
+	ErrUnexpectedCharacter = errors.New("unexpected character")
+	ErrUnterminatedString  = errors.New("unterminated string")
+	ErrLengthMismatch      = errors.New("length mismatch")
+	ErrBadLength           = errors.New("bad length")
+	ErrBadEscape           = errors.New("bad escape sequence")
+	ErrBadHex              = errors.New("bad hexadecimal encoding")
+	ErrBadBase64           = errors.New("bad base64 encoding")
+	ErrEmptyDisplayHint    = errors.New("empty display hint")
+	ErrTrailingData        = errors.New("unexpected data after S-expression")
+)
+
+// A SyntaxError describes malformed input, and where it was found.
+type SyntaxError struct {
+	Kind     error  // one of the Err variables above, or io.ErrUnexpectedEOF
+	Offset   int64  // offset in bytes of the error from the start of input
+	Line     int    // line of the error, counting from 1
+	Column   int    // column of the error in bytes, counting from 1
+	Expected string // what was expected, if known
+	Found    string // what was found instead, if known
+	Context  string // the input surrounding the error
+}
+
+func (e *SyntaxError) Error() string {
+	msg := fmt.Sprintf("line %d, column %d (offset %d): %v", e.Line, e.Column, e.Offset, e.Kind)
+	switch {
+	case e.Expected != "" && e.Found != "":
+		msg += "; expected " + e.Expected + ", found " + e.Found
+	case e.Expected != "":
+		msg += "; expected " + e.Expected
+	case e.Found != "":
+		msg += "; found " + e.Found
+	}
+	return msg
+}
+
+// Unwrap returns the kind of the error, so that errors.Is may be used
+// to test it.
+func (e *SyntaxError) Unwrap() error {
+	return e.Kind
+}
+
+// describe returns a description of byte c for error messages.
+func describe(c byte) string {
+	if c >= 0x80 {
+		return fmt.Sprintf("byte %#02x", c)
+	}
+	return strconv.QuoteRune(rune(c))
+}
+
+const endOfInput = "end of input"
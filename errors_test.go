@@ -0,0 +1,79 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxError(t *testing.T) {
+	for _, test := range []struct {
+		input        string
+		kind         error
+		offset       int64
+		line, column int
+	}{
+		{"(a b", io.ErrUnexpectedEOF, 4, 1, 5},
+		{"(a\n  b\n  \"c)", ErrUnterminatedString, 12, 3, 6},
+		{"(a\n  [b c)", ErrUnexpectedCharacter, 7, 2, 5},
+		{"(a\n)\n)", ErrUnexpectedCharacter, 0, 1, 1},
+		{"(a\n  4:abc)", io.ErrUnexpectedEOF, 11, 2, 9},
+		{"(5\"abc\")", ErrLengthMismatch, 6, 1, 7},
+		{"(\"a\\qb\")", ErrBadEscape, 4, 1, 5},
+		{"(\"a\\x4g\")", ErrBadEscape, 6, 1, 7},
+		{"(#61 6z#)", ErrBadHex, 7, 1, 8},
+		{"(|YW!j|)", ErrBadBase64, 6, 1, 7},
+		{"(3#616263 64#)", ErrLengthMismatch, 10, 1, 11},
+		{"(99999999999:a)", ErrBadLength, 12, 1, 13},
+		{"(a {KDE6YQ==})", io.ErrUnexpectedEOF, 12, 1, 13},
+		{"(\x01)", ErrUnexpectedCharacter, 1, 1, 2},
+	} {
+		var err error
+		if test.input == "(a\n)\n)" {
+			// the first expression is fine; the second is not
+			d := NewDecoder(strings.NewReader(test.input))
+			if _, err = d.Decode(); err != nil {
+				t.Fatal(err)
+			}
+			_, err = d.Decode()
+			test.offset, test.line = 5, 3
+		} else {
+			_, _, err = Parse([]byte(test.input))
+		}
+		var se *SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("%q: expected SyntaxError; got %v", test.input, err)
+			continue
+		}
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%q: expected %v; got %v", test.input, test.kind, err)
+		}
+		if se.Offset != test.offset || se.Line != test.line || se.Column != test.column {
+			t.Errorf("%q: expected offset %d, line %d, column %d; got %v", test.input, test.offset, test.line, test.column, err)
+		}
+		if !strings.Contains(test.input, se.Context) {
+			t.Errorf("%q: bad context %q", test.input, se.Context)
+		}
+	}
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	_, _, err := Parse([]byte("(a\n  [b c)"))
+	expected := "line 2, column 5 (offset 7): unexpected character; expected ']' to end display hint, found ' '"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected %q; got %v", expected, err)
+	}
+}
+
+func TestLimitErrorNotSyntaxError(t *testing.T) {
+	_, _, err := Limits{MaxDepth: 1}.Parse([]byte("((a))"))
+	var se *SyntaxError
+	if errors.As(err, &se) || !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected LimitError; got %v", err)
+	}
+}
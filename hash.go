@@ -0,0 +1,190 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"hash"
+
+	"github.com/pkg/errors"
+)
+
+// Hash writes the canonical representation of s to h, without first
+// building it in memory, and returns the resulting digest.  h is not
+// reset beforehand, so that Hash(s, sha256.New()) is equal to
+// sha256.Sum256(s.Pack()).
+func Hash(s Sexp, h hash.Hash) []byte {
+	w := bufio.NewWriter(h)
+	writeCanonical(w, s)
+	// writing to a hash.Hash never fails
+	w.Flush()
+	return h.Sum(nil)
+}
+
+// A MerkleTree caches a digest of every element of an S-expression, so
+// that after editing it only the digests of the lists containing the
+// edit need be recomputed.  The digest of an atom is the hash of a zero
+// byte followed by its canonical representation; that of a list is the
+// hash of a one byte followed by the digests of its elements.  The
+// digests are thus distinct from those returned by Hash.
+//
+// Elements are addressed by paths: the indices of the successive lists
+// containing them, starting from the root.  The empty path addresses
+// the whole S-expression.
+type MerkleTree struct {
+	newHash func() hash.Hash
+	root    *merkleNode
+}
+
+type merkleNode struct {
+	sexp     Sexp
+	digest   []byte
+	children []*merkleNode // if sexp is a List
+}
+
+const (
+	merkleAtom = 0x00
+	merkleList = 0x01
+)
+
+// NewMerkleTree returns a MerkleTree of s, whose digests are computed
+// with hashes returned by newHash, e.g. sha256.New.
+func NewMerkleTree(s Sexp, newHash func() hash.Hash) *MerkleTree {
+	t := &MerkleTree{newHash: newHash}
+	t.root = t.build(s)
+	return t
+}
+
+func (t *MerkleTree) build(s Sexp) *merkleNode {
+	n := &merkleNode{sexp: s}
+	if l, ok := s.(List); ok {
+		n.children = make([]*merkleNode, len(l))
+		for i, element := range l {
+			n.children[i] = t.build(element)
+		}
+	}
+	t.rehash(n)
+	return n
+}
+
+// rehash recomputes the digest of n from the digests of its children.
+func (t *MerkleTree) rehash(n *merkleNode) {
+	h := t.newHash()
+	if _, ok := n.sexp.(List); ok {
+		h.Write([]byte{merkleList})
+		for _, child := range n.children {
+			h.Write(child.digest)
+		}
+		n.digest = h.Sum(nil)
+		return
+	}
+	h.Write([]byte{merkleAtom})
+	n.digest = Hash(n.sexp, h)
+}
+
+// Sum returns the digest of the whole S-expression.
+func (t *MerkleTree) Sum() []byte {
+	return append([]byte{}, t.root.digest...)
+}
+
+// Sexp returns the S-expression, as edited.  It must not be modified.
+func (t *MerkleTree) Sexp() Sexp {
+	return t.root.sexp
+}
+
+// Digest returns the digest of the element at path.
+func (t *MerkleTree) Digest(path ...int) ([]byte, error) {
+	nodes, err := t.walk(path)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, nodes[len(nodes)-1].digest...), nil
+}
+
+// walk returns the nodes along path, starting with the root.
+func (t *MerkleTree) walk(path []int) ([]*merkleNode, error) {
+	nodes := []*merkleNode{t.root}
+	n := t.root
+	for depth, i := range path {
+		if _, ok := n.sexp.(List); !ok {
+			return nil, errors.Errorf("path %v: element %v is not a list", path, path[:depth])
+		}
+		if i < 0 || i >= len(n.children) {
+			return nil, errors.Errorf("path %v: index %d out of range", path, i)
+		}
+		n = n.children[i]
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
+
+// update rebuilds the lists and digests of nodes, the path from the
+// root to a list whose children have changed, from the bottom up.
+// Lists are copied rather than modified, so that S-expressions
+// previously returned by Sexp are unaffected.
+func (t *MerkleTree) update(nodes []*merkleNode) {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		l := make(List, len(n.children))
+		for j, child := range n.children {
+			l[j] = child.sexp
+		}
+		n.sexp = l
+		t.rehash(n)
+	}
+}
+
+// Replace replaces the element at path with s.
+func (t *MerkleTree) Replace(s Sexp, path ...int) error {
+	if len(path) == 0 {
+		t.root = t.build(s)
+		return nil
+	}
+	nodes, err := t.walk(path)
+	if err != nil {
+		return err
+	}
+	parent := nodes[len(nodes)-2]
+	parent.children[path[len(path)-1]] = t.build(s)
+	t.update(nodes[:len(nodes)-1])
+	return nil
+}
+
+// Insert inserts s into the list at path, before the element at index
+// i; if i is the length of the list, s is appended.
+func (t *MerkleTree) Insert(s Sexp, i int, path ...int) error {
+	nodes, err := t.walk(path)
+	if err != nil {
+		return err
+	}
+	n := nodes[len(nodes)-1]
+	if _, ok := n.sexp.(List); !ok {
+		return errors.Errorf("path %v: not a list", path)
+	}
+	if i < 0 || i > len(n.children) {
+		return errors.Errorf("path %v: index %d out of range", path, i)
+	}
+	n.children = append(n.children, nil)
+	copy(n.children[i+1:], n.children[i:])
+	n.children[i] = t.build(s)
+	t.update(nodes)
+	return nil
+}
+
+// Delete removes the element at path.
+func (t *MerkleTree) Delete(path ...int) error {
+	if len(path) == 0 {
+		return errors.New("can't delete the root")
+	}
+	nodes, err := t.walk(path)
+	if err != nil {
+		return err
+	}
+	parent := nodes[len(nodes)-2]
+	i := path[len(path)-1]
+	parent.children = append(parent.children[:i:i], parent.children[i+1:]...)
+	t.update(nodes[:len(nodes)-1])
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	s, _, err := Parse([]byte("(foo bar [bin]\"baz quux\" (() #00ff#))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256(s.Pack())
+	if digest := Hash(s, sha256.New()); !bytes.Equal(digest, expected[:]) {
+		t.Errorf("expected %x; got %x", expected, digest)
+	}
+}
+
+// countingHash counts the bytes written to it.
+type countingHash struct {
+	hash.Hash
+	n *int
+}
+
+func (h countingHash) Write(p []byte) (int, error) {
+	*h.n += len(p)
+	return h.Hash.Write(p)
+}
+
+func TestMerkleTree(t *testing.T) {
+	s, _, err := Parse([]byte("(a (b c) (d (e f)))"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewMerkleTree(s, sha256.New)
+	for _, edit := range []struct {
+		apply    func() error
+		expected string
+	}{
+		{func() error { return tree.Replace(Atom{Value: []byte("x")}, 2, 1, 0) }, "(a (b c) (d (x f)))"},
+		{func() error { return tree.Insert(Atom{Value: []byte("y")}, 1, 1) }, "(a (b y c) (d (x f)))"},
+		{func() error { return tree.Insert(List{}, 3) }, "(a (b y c) (d (x f)) ())"},
+		{func() error { return tree.Delete(0) }, "((b y c) (d (x f)) ())"},
+		{func() error { return tree.Replace(List{Atom{Value: []byte("z")}}, 1) }, "((b y c) (z) ())"},
+		{func() error { return tree.Replace(Atom{Value: []byte("root")}) }, "root"},
+	} {
+		before := tree.Sexp().String()
+		if err := edit.apply(); err != nil {
+			t.Fatal(err)
+		}
+		if tree.Sexp().String() != edit.expected {
+			t.Fatalf("expected %s; got %s", edit.expected, tree.Sexp())
+		}
+		fresh := NewMerkleTree(tree.Sexp(), sha256.New)
+		if !bytes.Equal(tree.Sum(), fresh.Sum()) {
+			t.Fatalf("%s: digest differs from that of a fresh tree", edit.expected)
+		}
+		if tree.Sexp().String() == before {
+			t.Fatal("edit had no effect")
+		}
+	}
+}
+
+func TestMerkleTreeRehashesPath(t *testing.T) {
+	// a long list of long atoms, of which one is edited
+	l := make(List, 1000)
+	for i := range l {
+		l[i] = List{Atom{Value: bytes.Repeat([]byte{byte(i)}, 1000)}}
+	}
+	n := 0
+	newHash := func() hash.Hash { return countingHash{sha256.New(), &n} }
+	tree := NewMerkleTree(l, newHash)
+	full := n
+	n = 0
+	if err := tree.Replace(Atom{Value: []byte("x")}, 500, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the root rehashes 1000 digests; the edited list and atom very little
+	if n > 1000*sha256.Size+100 || n*10 > full {
+		t.Errorf("edit hashed %d bytes; building hashed %d", n, full)
+	}
+	digest, err := tree.Digest(500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tree.Digest(500, 0, 0); err == nil {
+		t.Error("path into an atom accepted")
+	}
+	if _, err = tree.Digest(1000); err == nil {
+		t.Error("out-of-range path accepted")
+	}
+	atom := NewMerkleTree(Atom{Value: []byte("x")}, sha256.New)
+	if !bytes.Equal(digest, atom.Sum()) {
+		t.Error("subtree digest differs from that of the subtree alone")
+	}
+	// the original list is untouched
+	if !l[500].Equal(List{Atom{Value: bytes.Repeat([]byte{244}, 1000)}}) {
+		t.Error("edit modified the original S-expression")
+	}
+}
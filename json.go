@@ -0,0 +1,288 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// A JSONMapping converts S-expressions to and from JSON, losslessly:
+// an S-expression converted to JSON and back is Equal to the original,
+// and so packs to the same bytes.
+//
+// A list is mapped to an array of its elements.  An atom whose value
+// is UTF-8 and which has no display hint is mapped to a string; any
+// other atom to an object with the members
+//    "value" or "b64"        its value, as a string or in base64
+//    "hint" or "hint_b64"    its display hint, if any, likewise
+// e.g. [image/png]#89504e47# is mapped to
+// {"hint":"image/png","b64":"iVBORw=="}.
+//
+// In object mode, a non-empty list each of whose elements is a
+// (key value) list, with distinct UTF-8 keys without display hints, is
+// instead mapped to an object with a member for each element, in
+// order, e.g. ((host example.com) (port "80")) to
+// {"host":"example.com","port":"80"} -- unless its keys are only those
+// of an atom, when it remains an array.
+type JSONMapping struct {
+	Objects bool // whether to use object mode
+}
+
+// ToJSON returns the JSON mapping of s, not in object mode.
+func ToJSON(s Sexp) ([]byte, error) {
+	return JSONMapping{}.Marshal(s)
+}
+
+// FromJSON returns the S-expression mapped to the JSON b.
+func FromJSON(b []byte) (Sexp, error) {
+	return JSONMapping{}.Unmarshal(b)
+}
+
+// the members of an object to which an atom is mapped
+var jsonAtomKeys = map[string]bool{"value": true, "b64": true, "hint": true, "hint_b64": true}
+
+// Marshal returns the JSON mapping of s.
+func (m JSONMapping) Marshal(s Sexp) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := m.encode(buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (m JSONMapping) encode(buf *bytes.Buffer, s Sexp) error {
+	switch s := s.(type) {
+	case Atom:
+		encodeJSONAtom(buf, s)
+		return nil
+	case List:
+		if m.Objects && jsonObjectKeys(s) {
+			buf.WriteByte('{')
+			for i, element := range s {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				pair := element.(List)
+				writeJSONString(buf, string(pair[0].(Atom).Value))
+				buf.WriteByte(':')
+				if err := m.encode(buf, pair[1]); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte('}')
+			return nil
+		}
+		buf.WriteByte('[')
+		for i, element := range s {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := m.encode(buf, element); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+	return errors.Errorf("can't map %T to JSON", s)
+}
+
+func encodeJSONAtom(buf *bytes.Buffer, a Atom) {
+	if len(a.DisplayHint) == 0 && utf8.Valid(a.Value) {
+		writeJSONString(buf, string(a.Value))
+		return
+	}
+	buf.WriteByte('{')
+	if len(a.DisplayHint) > 0 {
+		writeJSONMember(buf, "hint", a.DisplayHint)
+		buf.WriteByte(',')
+	}
+	writeJSONMember(buf, "value", a.Value)
+	buf.WriteByte('}')
+}
+
+// writeJSONMember writes the member name, or name_b64 if b is not
+// UTF-8, with the value b.
+func writeJSONMember(buf *bytes.Buffer, name string, b []byte) {
+	if utf8.Valid(b) {
+		writeJSONString(buf, name)
+		buf.WriteByte(':')
+		writeJSONString(buf, string(b))
+		return
+	}
+	if name == "value" {
+		name = "b64"
+	} else {
+		name += "_b64"
+	}
+	writeJSONString(buf, name)
+	buf.WriteByte(':')
+	writeJSONString(buf, base64.StdEncoding.EncodeToString(b))
+}
+
+// writeJSONString writes s, which must be UTF-8, as a JSON string.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	// encoding a string can't fail
+	enc.Encode(s)
+	// drop the newline written by Encode
+	buf.Truncate(buf.Len() - 1)
+}
+
+// jsonObjectKeys reports whether l may be mapped to an object in object
+// mode.
+func jsonObjectKeys(l List) bool {
+	if len(l) == 0 {
+		return false
+	}
+	keys := make(map[string]bool, len(l))
+	atomKeys := true
+	for _, element := range l {
+		pair, ok := element.(List)
+		if !ok || len(pair) != 2 {
+			return false
+		}
+		key, ok := pair[0].(Atom)
+		if !ok || len(key.DisplayHint) > 0 || !utf8.Valid(key.Value) || keys[string(key.Value)] {
+			return false
+		}
+		keys[string(key.Value)] = true
+		atomKeys = atomKeys && jsonAtomKeys[string(key.Value)]
+	}
+	return !atomKeys
+}
+
+// Unmarshal returns the S-expression mapped to the JSON b.  Objects
+// other than those to which atoms are mapped are accepted in either
+// mode, becoming lists of (key value) lists; numbers and booleans
+// become atoms of their JSON text.  null has no mapping.
+func (m JSONMapping) Unmarshal(b []byte) (Sexp, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	s, err := decodeJSON(d)
+	if err != nil {
+		return nil, errors.Wrap(err, "JSON")
+	}
+	if _, err = d.Token(); err != io.EOF {
+		return nil, errors.New("JSON: unexpected data after value")
+	}
+	return s, nil
+}
+
+func decodeJSON(d *json.Decoder) (Sexp, error) {
+	t, err := d.Token()
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case string:
+		return Atom{Value: []byte(t)}, nil
+	case json.Number:
+		return Atom{Value: []byte(t)}, nil
+	case bool:
+		return Atom{Value: []byte(strconv.FormatBool(t))}, nil
+	case json.Delim:
+		if t == '{' {
+			return decodeJSONObject(d)
+		}
+		l := List{}
+		for d.More() {
+			element, err := decodeJSON(d)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, element)
+		}
+		// the closing ]
+		_, err = d.Token()
+		return l, err
+	}
+	return nil, errors.New("null has no S-expression")
+}
+
+func decodeJSONObject(d *json.Decoder) (Sexp, error) {
+	l := List{}
+	atomKeys := true
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := t.(string)
+		value, err := decodeJSON(d)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, List{Atom{Value: []byte(key)}, value})
+		atomKeys = atomKeys && jsonAtomKeys[key]
+	}
+	// the closing }
+	if _, err := d.Token(); err != nil {
+		return nil, err
+	}
+	if len(l) == 0 || !atomKeys {
+		return l, nil
+	}
+	return jsonAtom(l)
+}
+
+// jsonAtom returns the atom mapped to the object whose members are the
+// (key value) lists l.
+func jsonAtom(l List) (Sexp, error) {
+	members := make(map[string][]byte, len(l))
+	for _, element := range l {
+		pair := element.(List)
+		key := string(pair[0].(Atom).Value)
+		value, ok := pair[1].(Atom)
+		if !ok || len(value.DisplayHint) > 0 {
+			return nil, errors.Errorf("atom member %q is not a string", key)
+		}
+		if _, duplicate := members[key]; duplicate {
+			return nil, errors.Errorf("atom member %q repeated", key)
+		}
+		b := value.Value
+		if key == "b64" || key == "hint_b64" {
+			var err error
+			if b, err = base64.StdEncoding.DecodeString(string(b)); err != nil {
+				return nil, errors.Wrapf(err, "atom member %q", key)
+			}
+		}
+		members[key] = b
+	}
+	var a Atom
+	switch value, b64 := members["value"], members["b64"]; {
+	case value != nil && b64 != nil:
+		return nil, errors.New(`atom has both "value" and "b64"`)
+	case value != nil:
+		a.Value = value
+	case b64 != nil:
+		a.Value = b64
+	default:
+		return nil, errors.New(`atom has neither "value" nor "b64"`)
+	}
+	switch hint, b64 := members["hint"], members["hint_b64"]; {
+	case hint != nil && b64 != nil:
+		return nil, errors.New(`atom has both "hint" and "hint_b64"`)
+	case hint != nil:
+		a.DisplayHint = hint
+	case b64 != nil:
+		a.DisplayHint = b64
+	}
+	if a.DisplayHint != nil && len(a.DisplayHint) == 0 {
+		return nil, ErrEmptyDisplayHint
+	}
+	return a, nil
+}
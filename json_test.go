@@ -0,0 +1,123 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	for _, test := range []struct {
+		sexp, json, objects string // objects is the object mode mapping, if different
+	}{
+		{"foo", `"foo"`, ""},
+		{`""`, `""`, ""},
+		{`"<a & b>"`, `"<a & b>"`, ""},
+		{`"caf\303\251"`, `"café"`, ""},
+		{`"line\nbreak"`, `"line\nbreak"`, ""},
+		{"#ff00#", `{"b64":"/wA="}`, ""},
+		{"[text/plain]foo", `{"hint":"text/plain","value":"foo"}`, ""},
+		{"[image/png]#89504e47#", `{"hint":"image/png","b64":"iVBORw=="}`, ""},
+		{"[#ff#]foo", `{"hint_b64":"/w==","value":"foo"}`, ""},
+		{"()", `[]`, ""},
+		{"(a (b c) ())", `["a",["b","c"],[]]`, ""},
+		{`((host example.com) (port "80"))`, `[["host","example.com"],["port","80"]]`, `{"host":"example.com","port":"80"}`},
+		{`((a (b c)) (d ((e f))))`, `[["a",["b","c"]],["d",[["e","f"]]]]`, `{"a":["b","c"],"d":{"e":"f"}}`},
+		// not pair lists
+		{`((a b) c)`, `[["a","b"],"c"]`, ""},
+		{`((a b c))`, `[["a","b","c"]]`, ""},
+		{`((a b) (a c))`, `[["a","b"],["a","c"]]`, ""},
+		{`(([h]a b))`, `[[{"hint":"h","value":"a"},"b"]]`, ""},
+		{`(((a) b))`, `[[["a"],"b"]]`, ""},
+		// keys which would be taken for an atom
+		{`((hint x) (value y))`, `[["hint","x"],["value","y"]]`, ""},
+		{`((hint x) (other y))`, `[["hint","x"],["other","y"]]`, `{"hint":"x","other":"y"}`},
+	} {
+		s := parseString(t, test.sexp)
+		for _, m := range []JSONMapping{{}, {Objects: true}} {
+			expected := test.json
+			if m.Objects && test.objects != "" {
+				expected = test.objects
+			}
+			b, err := m.Marshal(s)
+			if err != nil {
+				t.Errorf("%s: %v", test.sexp, err)
+				continue
+			}
+			if string(b) != expected {
+				t.Errorf("%s, objects %v: expected %s; got %s", test.sexp, m.Objects, expected, b)
+			}
+			result, err := m.Unmarshal(b)
+			if err != nil {
+				t.Errorf("%s: %s: %v", test.sexp, b, err)
+				continue
+			}
+			if !bytes.Equal(result.Pack(), s.Pack()) {
+				t.Errorf("%s, objects %v: %s round-tripped to %s", test.sexp, m.Objects, b, result)
+			}
+		}
+	}
+}
+
+func TestFromJSON(t *testing.T) {
+	for _, test := range []struct {
+		json, sexp string
+	}{
+		{` [ 1, -2.5e3, true, false ] `, `("1" "-2.5e3" true false)`},
+		{`{}`, `()`},
+		{`{"port": 80}`, `((port "80"))`},
+		{`{"value": "x"}`, `x`},
+		{`{"value": 1}`, `"1"`},
+		{`{"b64": ""}`, `""`},
+	} {
+		s, err := FromJSON([]byte(test.json))
+		if err != nil {
+			t.Errorf("%s: %v", test.json, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.sexp)) {
+			t.Errorf("%s: expected %s; got %s", test.json, test.sexp, s)
+		}
+	}
+	for _, json := range []string{
+		``,
+		`null`,
+		`[null]`,
+		`[1`,
+		`"a" "b"`,
+		`{"hint": "x"}`,
+		`{"value": "x", "b64": "eA=="}`,
+		`{"value": "x", "hint": "a", "hint_b64": "eA=="}`,
+		`{"value": "x", "value": "y"}`,
+		`{"b64": "not base64!"}`,
+		`{"value": ["x"]}`,
+		`{"value": {"value": "x", "hint": "h"}}`,
+		`{"value": "x", "hint": ""}`,
+	} {
+		if s, err := FromJSON([]byte(json)); err == nil {
+			t.Errorf("%s: expected error; got %s", json, s)
+		}
+	}
+	if _, err := FromJSON([]byte(`{"value": "x", "hint": ""}`)); !errors.Is(err, ErrEmptyDisplayHint) {
+		t.Errorf("expected ErrEmptyDisplayHint; got %v", err)
+	}
+}
+
+func ExampleJSONMapping() {
+	s, _, err := Parse([]byte(`((host [idn]example.com) (port "80") (tags (a b)))`))
+	if err != nil {
+		panic(err)
+	}
+	b, err := JSONMapping{Objects: true}.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(string(b))
+	// Output:
+	// {"host":{"hint":"idn","value":"example.com"},"port":"80","tags":["a","b"]}
+}
@@ -0,0 +1,105 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Limits bounds the resources consumed in reading a single
+// S-expression, so that untrusted input cannot exhaust memory or the
+// stack.  A zero field imposes no limit.  Exceeding any limit causes
+// reading to stop with a *LimitError.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of lists.
+	MaxDepth int
+
+	// MaxAtomLen is the maximum length in bytes of an atom's value.
+	MaxAtomLen int64
+
+	// MaxHintLen is the maximum length in bytes of a display hint.
+	MaxHintLen int64
+
+	// MaxListLen is the maximum number of elements in a list.
+	MaxListLen int
+
+	// MaxBytes is the maximum number of input bytes consumed.
+	MaxBytes int64
+}
+
+// DefaultLimits are the limits enforced by Read, Parse, ReadCanonical,
+// ParseCanonical and new Decoders.  They only bound list nesting, to
+// protect the stack; lengths read from the input are never trusted to
+// allocate memory in advance, so callers reading untrusted input need
+// only set the limits they care about.
+var DefaultLimits = Limits{MaxDepth: 1024}
+
+// ErrLimitExceeded is reported by errors.Is for every *LimitError.
+var ErrLimitExceeded = errors.New("limit exceeded")
+
+// A LimitError reports that input exceeded one of a reader's Limits.
+type LimitError struct {
+	Limit string // the name of the field of Limits exceeded
+	Max   int64  // the value of that field
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeded", e.Limit, e.Max)
+}
+
+// Is reports whether target is ErrLimitExceeded.
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// Read reads a single S-expression from r, as the package-level Read
+// does, enforcing l.
+func (l Limits) Read(r *bufio.Reader) (s Sexp, err error) {
+	p := &reader{r: r, limits: l}
+	return p.read()
+}
+
+// Parse returns the first S-expression in s, the unparsed rest of s
+// and any error encountered, as the package-level Parse does,
+// enforcing l.
+func (l Limits) Parse(s []byte) (sexpr Sexp, rest []byte, err error) {
+	p := &reader{r: bufio.NewReader(bytes.NewReader(s)), limits: l}
+	sexpr, err = p.read()
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	// don't confuse calling code with EOFs
+	return sexpr, s[p.n:], nil
+}
+
+// ReadCanonical reads a single canonical S-expression from r, as the
+// package-level ReadCanonical does, enforcing l.
+func (l Limits) ReadCanonical(r *bufio.Reader) (s Sexp, err error) {
+	if _, err = r.Peek(1); err != nil {
+		// io.EOF between expressions is not an error
+		return nil, err
+	}
+	p := &reader{r: r, limits: l}
+	return p.readCanonical()
+}
+
+// ParseCanonical parses b, which must consist of exactly one canonical
+// S-expression, as the package-level ParseCanonical does, enforcing l.
+func (l Limits) ParseCanonical(b []byte) (s Sexp, err error) {
+	p := &reader{r: bufio.NewReader(bytes.NewReader(b)), limits: l}
+	if s, err = p.readCanonical(); err != nil {
+		return nil, err
+	}
+	if p.n != int64(len(b)) {
+		c, _ := p.readByte()
+		return nil, p.syntaxError(ErrTrailingData, endOfInput, describe(c))
+	}
+	return s, nil
+}
@@ -0,0 +1,109 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		limits Limits
+		limit  string
+	}{
+		{"((((a))))", Limits{MaxDepth: 3}, "MaxDepth"},
+		{"(1:a(2:bc))", Limits{MaxDepth: 1}, "MaxDepth"},
+		{"{KCgoYSkpKQ==}", Limits{MaxDepth: 2}, "MaxDepth"},
+		{"2147483647:", Limits{MaxAtomLen: 1024}, "MaxAtomLen"},
+		{"abcdef", Limits{MaxAtomLen: 5}, "MaxAtomLen"},
+		{`"abcdef"`, Limits{MaxAtomLen: 5}, "MaxAtomLen"},
+		{"#616263646566#", Limits{MaxAtomLen: 5}, "MaxAtomLen"},
+		{"|YWJjZGVm|", Limits{MaxAtomLen: 5}, "MaxAtomLen"},
+		{"[abcdef]a", Limits{MaxHintLen: 5}, "MaxHintLen"},
+		{"[6:abcdef]a", Limits{MaxHintLen: 5}, "MaxHintLen"},
+		{"(a b c d)", Limits{MaxListLen: 3}, "MaxListLen"},
+		{"(3:abc)", Limits{MaxBytes: 5}, "MaxBytes"},
+		{"(a          b)", Limits{MaxBytes: 8}, "MaxBytes"},
+		{"100:abc", Limits{MaxBytes: 50}, "MaxBytes"},
+	} {
+		_, _, err := test.limits.Parse([]byte(test.input))
+		var le *LimitError
+		if !errors.As(err, &le) {
+			t.Errorf("%q: expected *LimitError; got %v", test.input, err)
+			continue
+		}
+		if le.Limit != test.limit {
+			t.Errorf("%q: expected %s to be exceeded; got %v", test.input, test.limit, le)
+		}
+		if !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%q: errors.Is(%v, ErrLimitExceeded) is false", test.input, err)
+		}
+	}
+}
+
+func TestLimitsCanonical(t *testing.T) {
+	for _, test := range []struct {
+		input  string
+		limits Limits
+		limit  string
+	}{
+		{"(((1:a)))", Limits{MaxDepth: 2}, "MaxDepth"},
+		{"6:abcdef", Limits{MaxAtomLen: 5}, "MaxAtomLen"},
+		{"[6:abcdef]1:a", Limits{MaxHintLen: 5}, "MaxHintLen"},
+		{"(1:a1:b)", Limits{MaxListLen: 1}, "MaxListLen"},
+		{"(1:a1:b)", Limits{MaxBytes: 7}, "MaxBytes"},
+	} {
+		_, err := test.limits.ParseCanonical([]byte(test.input))
+		var le *LimitError
+		if !errors.As(err, &le) || le.Limit != test.limit {
+			t.Errorf("%q: expected %s to be exceeded; got %v", test.input, test.limit, err)
+		}
+	}
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	limits := Limits{MaxDepth: 2, MaxAtomLen: 3, MaxHintLen: 3, MaxListLen: 2, MaxBytes: 21}
+	for _, input := range []string{"(abc ([bin]def))", "(3:abc([3:bin]3:def))"} {
+		if _, _, err := limits.Parse([]byte(input)); err != nil {
+			t.Errorf("%q: %v", input, err)
+		}
+	}
+	if _, err := limits.ParseCanonical([]byte("(3:abc([3:bin]3:def))")); err != nil {
+		t.Error(err)
+	}
+	limits.MaxBytes--
+	if _, err := limits.ParseCanonical([]byte("(3:abc([3:bin]3:def))")); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected MaxBytes to be exceeded; got %v", err)
+	}
+}
+
+func TestDefaultLimitsDepth(t *testing.T) {
+	deep := strings.Repeat("(", 100000) + strings.Repeat(")", 100000)
+	if _, err := Read(bufio.NewReader(strings.NewReader(deep))); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected limit to be exceeded; got %v", err)
+	}
+	d := NewDecoder(strings.NewReader(deep))
+	d.SetLimits(Limits{})
+	if _, err := d.Decode(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDefaultLimitsLength(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, _, err := Parse([]byte(`2147483647"a"`)); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("expected length mismatch; got %v", err)
+	}
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for a 1-byte string", n)
+	}
+}
@@ -0,0 +1,464 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Marshaler is the interface implemented by types which can encode
+// themselves as S-expressions.
+type Marshaler interface {
+	MarshalSexp() (Sexp, error)
+}
+
+// Unmarshaler is the interface implemented by types which can decode
+// an S-expression encoding of themselves.  UnmarshalSexp must copy s
+// if it wishes to retain it after returning.
+type Unmarshaler interface {
+	UnmarshalSexp(s Sexp) error
+}
+
+// Marshal returns the S-expression encoding of v, in the manner of
+// encoding/json's Marshal.
+//
+// If a value implements Marshaler, either directly or through a
+// pointer receiver, Marshal calls its MarshalSexp method to encode it.
+// Otherwise:
+//
+// Strings, byte slices and byte arrays are encoded as atoms of their
+// bytes; integers and floating-point numbers as atoms of their decimal
+// representation; and booleans as the atoms true and false.  Slices
+// and arrays of other types are encoded as lists of their elements,
+// and maps as lists of (key value) lists, sorted by key.  Values which
+// are already Sexps are encoded as themselves.  Pointers and
+// interfaces are encoded as the values they point to or contain.
+//
+// A struct is encoded as a list headed by its type name, followed by a
+// (name value) list for each exported field, e.g.:
+//    (validity (not-before "2013-01-01") (not-after "2014-01-01"))
+// Type and field names are converted from CamelCase to lower-case
+// words separated by hyphens.  The type name may be overridden by
+// tagging a blank field, e.g. _ struct{} `sexp:"cert"`, and a field's
+// encoding may be customised by its tag:
+//    // Field appears as (name ...).
+//    Field int `sexp:"name"`
+//    // Field is omitted if it has its zero value.
+//    Field int `sexp:",omitempty"`
+//    // Field's atom has the display hint text/plain.
+//    Field string `sexp:",hint=text/plain"`
+//    // Field is ignored.
+//    Field int `sexp:"-"`
+// The fields of an embedded struct without a tag are encoded as if
+// they were fields of the outer struct.  Nil pointer and interface
+// fields are always omitted.
+//
+// Channels, functions and complex numbers cannot be encoded.
+func Marshal(v interface{}) (Sexp, error) {
+	if v == nil {
+		return nil, errors.New("can't marshal nil")
+	}
+	rv := reflect.ValueOf(v)
+	// make v addressable, so that pointer-receiver Marshalers are honoured
+	addressable := reflect.New(rv.Type()).Elem()
+	addressable.Set(rv)
+	return marshalValue(addressable, nil)
+}
+
+// Unmarshal decodes S-expression s into the value pointed to by v,
+// reversing the encoding performed by Marshal.  Values implementing
+// Unmarshaler, either directly or through a pointer receiver, decode
+// themselves with UnmarshalSexp.  Unknown struct fields
+// are ignored, as are the display hints of atoms; missing struct
+// fields are left unchanged.  Unmarshalling into an empty interface
+// value stores s itself.
+func Unmarshal(s Sexp, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("can't unmarshal into non-pointer or nil %T", v)
+	}
+	return unmarshalValue(s, rv.Elem())
+}
+
+var (
+	sexpType        = reflect.TypeOf((*Sexp)(nil)).Elem()
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	atomType        = reflect.TypeOf(Atom{})
+	listType        = reflect.TypeOf(List{})
+	byteType        = reflect.TypeOf(byte(0))
+	emptyType       = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// field describes how a struct field is encoded.
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+	hint      []byte
+}
+
+// structInfo returns the name under which a struct type is encoded,
+// which may be empty for anonymous types, and its encoded fields.
+func structInfo(t reflect.Type) (name string, fields []field) {
+	name = hyphenate(t.Name())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("sexp")
+		if f.Name == "_" {
+			if tag != "" {
+				name = tag
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		if f.Anonymous && opts[0] == "" && f.Type.Kind() == reflect.Struct {
+			_, embedded := structInfo(f.Type)
+			for _, e := range embedded {
+				e.index = append([]int{i}, e.index...)
+				fields = append(fields, e)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		fi := field{name: opts[0], index: []int{i}}
+		if fi.name == "" {
+			fi.name = hyphenate(f.Name)
+		}
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == "omitempty":
+				fi.omitEmpty = true
+			case strings.HasPrefix(opt, "hint="):
+				fi.hint = []byte(strings.TrimPrefix(opt, "hint="))
+			}
+		}
+		fields = append(fields, fi)
+	}
+	return name, fields
+}
+
+// hyphenate converts a CamelCase identifier to lower-case words
+// separated by hyphens, e.g. NotBefore to not-before and HTTPServer to
+// http-server.
+func hyphenate(s string) string {
+	runes := []rune(s)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '-')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// marshalValue encodes v, giving any atoms it produces directly the
+// display hint hint.
+func marshalValue(v reflect.Value, hint []byte) (Sexp, error) {
+	if m, ok := marshaler(v); ok {
+		s, err := m.MarshalSexp()
+		if err != nil {
+			return nil, errors.Wrapf(err, "couldn't marshal %v", v.Type())
+		}
+		if s == nil {
+			return nil, errors.Errorf("MarshalSexp of %v returned nil", v.Type())
+		}
+		return s, nil
+	}
+	if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, errors.Errorf("can't marshal nil %v", v.Type())
+		}
+		return marshalValue(v.Elem(), hint)
+	}
+	if v.Type().Implements(sexpType) {
+		return v.Interface().(Sexp), nil
+	}
+	atom := func(b []byte) Sexp {
+		return Atom{DisplayHint: hint, Value: b}
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return atom([]byte(v.String())), nil
+	case reflect.Bool:
+		return atom([]byte(strconv.FormatBool(v.Bool()))), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return atom(strconv.AppendInt(nil, v.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return atom(strconv.AppendUint(nil, v.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		return atom(strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits())), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem() == byteType {
+			if v.Kind() == reflect.Slice {
+				return atom(append([]byte{}, v.Bytes()...)), nil
+			}
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return atom(b), nil
+		}
+		l := make(List, v.Len())
+		for i := range l {
+			element, err := marshalValue(v.Index(i), hint)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = element
+		}
+		return l, nil
+	case reflect.Map:
+		keys := v.MapKeys()
+		pairs := make(List, 0, len(keys))
+		for _, key := range keys {
+			k, err := marshalValue(key, nil)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := k.(Atom); !ok {
+				return nil, errors.Errorf("can't marshal map key of type %v", key.Type())
+			}
+			value, err := marshalValue(v.MapIndex(key), hint)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, List{k, value})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			return string(pairs[i].(List)[0].(Atom).Value) < string(pairs[j].(List)[0].(Atom).Value)
+		})
+		return pairs, nil
+	case reflect.Struct:
+		return marshalStruct(v)
+	}
+	return nil, errors.Errorf("can't marshal value of type %v", v.Type())
+}
+
+// marshaler returns v, or its address, as a Marshaler if either
+// implements the interface.  Nil pointers are left to marshalValue.
+func marshaler(v reflect.Value) (Marshaler, bool) {
+	if v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	if v.Kind() != reflect.Interface && v.Type().Implements(marshalerType) {
+		return v.Interface().(Marshaler), true
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
+		return v.Addr().Interface().(Marshaler), true
+	}
+	return nil, false
+}
+
+func marshalStruct(v reflect.Value) (Sexp, error) {
+	name, fields := structInfo(v.Type())
+	l := make(List, 0, len(fields)+1)
+	if name != "" {
+		l = append(l, Atom{Value: []byte(name)})
+	}
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if (fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface) && fv.IsNil() {
+			continue
+		}
+		value, err := marshalValue(fv, f.hint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", f.name)
+		}
+		l = append(l, List{Atom{Value: []byte(f.name)}, value})
+	}
+	return l, nil
+}
+
+func unmarshalValue(s Sexp, v reflect.Value) error {
+	if s == nil {
+		return errors.New("can't unmarshal nil S-expression")
+	}
+	switch v.Type() {
+	case sexpType, emptyType:
+		v.Set(reflect.ValueOf(s))
+		return nil
+	case atomType, listType:
+		if reflect.TypeOf(s) != v.Type() {
+			return errors.Errorf("can't unmarshal %v into %v", s, v.Type())
+		}
+		v.Set(reflect.ValueOf(s))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(s, v.Elem())
+	}
+	if v.Kind() != reflect.Interface && v.Type().Implements(unmarshalerType) {
+		return v.Interface().(Unmarshaler).UnmarshalSexp(s)
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalSexp(s)
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem() == byteType {
+			break
+		}
+		l, ok := s.(List)
+		if !ok {
+			return errors.Errorf("expected list for %v; got %v", v.Type(), s)
+		}
+		if v.Kind() == reflect.Array {
+			if len(l) != v.Len() {
+				return errors.Errorf("expected %d elements for %v; got %d", v.Len(), v.Type(), len(l))
+			}
+		} else {
+			v.Set(reflect.MakeSlice(v.Type(), len(l), len(l)))
+		}
+		for i, element := range l {
+			if err := unmarshalValue(element, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		l, ok := s.(List)
+		if !ok {
+			return errors.Errorf("expected list for %v; got %v", v.Type(), s)
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for _, element := range l {
+			pair, ok := element.(List)
+			if !ok || len(pair) != 2 {
+				return errors.Errorf("expected (key value) list for %v; got %v", v.Type(), element)
+			}
+			key := reflect.New(v.Type().Key()).Elem()
+			if err := unmarshalValue(pair[0], key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := unmarshalValue(pair[1], value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+		return nil
+	case reflect.Struct:
+		return unmarshalStruct(s, v)
+	}
+	a, ok := s.(Atom)
+	if !ok {
+		return errors.Errorf("expected atom for %v; got %v", v.Type(), s)
+	}
+	str := string(a.Value)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return errors.Wrapf(err, "can't unmarshal %v into %v", a, v.Type())
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't unmarshal %v into %v", a, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(str, 10, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't unmarshal %v into %v", a, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(err, "can't unmarshal %v into %v", a, v.Type())
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		v.SetBytes(append([]byte{}, a.Value...))
+	case reflect.Array:
+		if len(a.Value) != v.Len() {
+			return errors.Errorf("expected %d bytes for %v; got %d", v.Len(), v.Type(), len(a.Value))
+		}
+		reflect.Copy(v, reflect.ValueOf(a.Value))
+	default:
+		return errors.Errorf("can't unmarshal into value of type %v", v.Type())
+	}
+	return nil
+}
+
+func unmarshalStruct(s Sexp, v reflect.Value) error {
+	l, ok := s.(List)
+	if !ok {
+		return errors.Errorf("expected list for %v; got %v", v.Type(), s)
+	}
+	name, fields := structInfo(v.Type())
+	if name != "" {
+		if len(l) == 0 || !l[0].Equal(Atom{Value: []byte(name)}) {
+			return errors.Errorf("expected list headed by %s for %v; got %v", name, v.Type(), s)
+		}
+		l = l[1:]
+	}
+	for _, element := range l {
+		pair, ok := element.(List)
+		if !ok || len(pair) != 2 {
+			return errors.Errorf("expected (name value) list for %v; got %v", v.Type(), element)
+		}
+		fieldName, ok := pair[0].(Atom)
+		if !ok {
+			return errors.Errorf("expected field name for %v; got %v", v.Type(), pair[0])
+		}
+		for _, f := range fields {
+			if f.name != string(fieldName.Value) {
+				continue
+			}
+			if err := unmarshalValue(pair[1], v.FieldByIndex(f.index)); err != nil {
+				return errors.Wrapf(err, "field %s", f.name)
+			}
+			break
+		}
+	}
+	return nil
+}
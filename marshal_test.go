@@ -0,0 +1,238 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type testValidity struct {
+	NotBefore string `sexp:",omitempty"`
+	NotAfter  string `sexp:",omitempty"`
+}
+
+type testCommon struct {
+	Serial uint64
+}
+
+type testCert struct {
+	_ struct{} `sexp:"cert"`
+	testCommon
+	Issuer   []byte `sexp:",hint=hash"`
+	Subject  []string
+	Delegate bool
+	Depth    int8
+	Weight   float64
+	Validity *testValidity
+	Tag      Sexp
+	Extra    map[string]int `sexp:"extra,omitempty"`
+	Ignored  string         `sexp:"-"`
+	private  int
+}
+
+func TestMarshal(t *testing.T) {
+	c := testCert{
+		testCommon: testCommon{Serial: 42},
+		Issuer:     []byte{0xde, 0xad},
+		Subject:    []string{"alice", "mother"},
+		Depth:      -3,
+		Weight:     0.5,
+		Validity:   &testValidity{NotAfter: "2014-01-01"},
+		Tag:        List{Atom{Value: []byte("*")}},
+		Extra:      map[string]int{"b": 2, "a": 1},
+		Ignored:    "ignored",
+		private:    7,
+	}
+	s, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `(cert (serial "42") (issuer [hash]|3q0=|) (subject (alice mother)) (delegate false) (depth -3) (weight "0.5") (validity (test-validity (not-after "2014-01-01"))) (tag (*)) (extra ((a "1") (b "2"))))`
+	if s.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, s)
+	}
+	var d testCert
+	if err = Unmarshal(s, &d); err != nil {
+		t.Fatal(err)
+	}
+	c.Ignored, c.private = "", 0
+	if !reflect.DeepEqual(c, d) {
+		t.Fatalf("expected %+v; got %+v", c, d)
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		v     interface{}
+	}{
+		{"(certificate)", new(testCert)},
+		{"(cert (depth \"300\"))", new(testCert)},
+		{"(cert (subject alice))", new(testCert)},
+		{"(cert (delegate maybe))", new(testCert)},
+		{"(a b)", new(Atom)},
+		{"abc", new([2]string)},
+	} {
+		s, _, err := Parse([]byte(test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = Unmarshal(s, test.v); err == nil {
+			t.Errorf("%s: expected error unmarshalling into %T", test.input, test.v)
+		}
+	}
+	if err := Unmarshal(Atom{Value: []byte("x")}, testCert{}); err == nil {
+		t.Error("expected error unmarshalling into non-pointer")
+	}
+}
+
+func TestMarshalValueRoundTrip(t *testing.T) {
+	var i interface{}
+	type anonymous struct{ A, B int }
+	in := struct {
+		Array [2]anonymous
+		Bytes [3]byte
+		Any   interface{}
+	}{
+		Array: [2]anonymous{{1, 2}, {3, 4}},
+		Bytes: [3]byte{'a', 'b', 'c'},
+		Any:   "foo",
+	}
+	buf := bytes.NewBuffer(nil)
+	if err := NewEncoder(buf).EncodeValue(in); err != nil {
+		t.Fatal(err)
+	}
+	out := in
+	out.Array, out.Bytes, out.Any = [2]anonymous{}, [3]byte{}, nil
+	if err := NewDecoder(buf).DecodeValue(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Array != in.Array || out.Bytes != in.Bytes {
+		t.Fatalf("expected %+v; got %+v", in, out)
+	}
+	if !(Atom{Value: []byte("foo")}).Equal(out.Any.(Sexp)) {
+		t.Fatalf("expected atom foo in interface; got %v", out.Any)
+	}
+	if err := Unmarshal(List{}, &i); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHyphenate(t *testing.T) {
+	for in, out := range map[string]string{
+		"":           "",
+		"Name":       "name",
+		"NotBefore":  "not-before",
+		"HTTPServer": "http-server",
+		"PublicKey2": "public-key2",
+		"Sha256Hash": "sha256-hash",
+	} {
+		if hyphenate(in) != out {
+			t.Errorf("hyphenate(%q) = %q; expected %q", in, hyphenate(in), out)
+		}
+	}
+}
+
+func ExampleMarshal() {
+	type Subject struct {
+		Name  string
+		Title string `sexp:",omitempty,hint=text/plain"`
+	}
+	s, err := Marshal(Subject{Name: "Alice", Title: "the boss"})
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s)
+	var subject Subject
+	if err = Unmarshal(s, &subject); err != nil {
+		panic(err)
+	}
+	fmt.Println(subject.Title)
+	// Output:
+	// (subject (name Alice) (title [text/plain]"the boss"))
+	// the boss
+}
+
+// testKey marshals itself with a pointer receiver.
+type testKey struct {
+	algorithm string
+	bits      []byte
+}
+
+func (k *testKey) MarshalSexp() (Sexp, error) {
+	return List{Atom{Value: []byte(k.algorithm)}, Atom{DisplayHint: []byte("bits"), Value: k.bits}}, nil
+}
+
+func (k *testKey) UnmarshalSexp(s Sexp) error {
+	l, ok := s.(List)
+	if !ok || len(l) != 2 {
+		return fmt.Errorf("bad key %v", s)
+	}
+	k.algorithm = string(l[0].(Atom).Value)
+	k.bits = append([]byte{}, l[1].(Atom).Value...)
+	return nil
+}
+
+// testTimestamp marshals itself with a value receiver.
+type testTimestamp int64
+
+func (ts testTimestamp) MarshalSexp() (Sexp, error) {
+	return Atom{DisplayHint: []byte("time"), Value: []byte(fmt.Sprintf("t%d", int64(ts)))}, nil
+}
+
+func (ts *testTimestamp) UnmarshalSexp(s Sexp) error {
+	a, ok := s.(Atom)
+	if !ok {
+		return fmt.Errorf("bad timestamp %v", s)
+	}
+	_, err := fmt.Sscanf(string(a.Value), "t%d", (*int64)(ts))
+	return err
+}
+
+type testKeyring struct {
+	Owner   testKey
+	Keys    []testKey
+	Backup  *testKey
+	Created testTimestamp
+	Expires map[string]testTimestamp
+}
+
+func TestMarshaler(t *testing.T) {
+	k := testKeyring{
+		Owner:   testKey{"ed25519", []byte("owner")},
+		Keys:    []testKey{{"rsa", []byte("a")}, {"ecdsa", []byte("b")}},
+		Backup:  &testKey{"ed25519", []byte("backup")},
+		Created: 1000,
+		Expires: map[string]testTimestamp{"owner": 2000},
+	}
+	s, err := Marshal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `(test-keyring (owner (ed25519 [bits]owner)) (keys ((rsa [bits]a) (ecdsa [bits]b))) (backup (ed25519 [bits]backup)) (created [time]t1000) (expires ((owner [time]t2000))))`
+	if s.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, s)
+	}
+	var d testKeyring
+	if err = Unmarshal(s, &d); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(k, d) {
+		t.Fatalf("expected %+v; got %+v", k, d)
+	}
+	// top-level values with pointer-receiver methods are honoured too
+	if s, err = Marshal(testKey{"rsa", []byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+	if s.String() != "(rsa [bits]c)" {
+		t.Fatalf("bad top-level encoding %v", s)
+	}
+	if err = Unmarshal(Atom{Value: []byte("bad")}, &d.Owner); err == nil {
+		t.Fatal("expected error from UnmarshalSexp")
+	}
+}
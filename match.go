@@ -0,0 +1,400 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// A Pattern matches S-expressions of a given shape, binding variables
+// to their subexpressions.  A pattern is itself an S-expression, in
+// which atoms beginning with ? are variables:
+//
+//    ?x           any S-expression, bound to x
+//    ?x:atom      any atom
+//    ?x:list      any list
+//    ?x...        within a list, zero or more consecutive elements,
+//                 bound to x as a List; ?x:atom... and ?x:list...
+//                 constrain each element
+//    ?            any S-expression, bound to nothing; likewise ?:atom,
+//                 ?... and so on
+//    [hint]?x     any atom with the display hint hint
+//    ??x          the atom ?x, literally
+//
+// All other atoms match only equal atoms, display hints included, and
+// lists match lists of matching elements.  A variable occurring more
+// than once must match equal S-expressions each time.  Where segment
+// variables make a match ambiguous, earlier ones match as few elements
+// as possible.
+//
+// For example, (cert (issuer ?i) (subject ?s) ?rest...) matches
+// (cert (issuer alice) (subject bob) (tag (*))), binding i to alice, s
+// to bob and rest to ((tag (*))).
+type Pattern struct {
+	sexp Sexp
+	root patternNode
+}
+
+type patternNode struct {
+	kind       int
+	literal    Atom          // if kind is literalNode
+	name       string        // if kind is variableNode; empty if anonymous
+	hint       []byte        // if kind is variableNode; nil if unconstrained
+	constraint int           // if kind is variableNode
+	segment    bool          // if kind is variableNode
+	elements   []patternNode // if kind is listNode
+}
+
+const (
+	literalNode = iota
+	variableNode
+	listNode
+)
+
+const (
+	anyConstraint = iota
+	atomConstraint
+	listConstraint
+)
+
+// Bindings maps the names of pattern variables to the S-expressions
+// they matched.  A segment variable is bound to a List of the elements
+// it matched.
+type Bindings map[string]Sexp
+
+// CompilePattern compiles pattern, so that it may be used with Match.
+func CompilePattern(pattern Sexp) (*Pattern, error) {
+	if pattern == nil {
+		return nil, errors.New("pattern: nil S-expression")
+	}
+	root, err := compilePattern(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pattern %s", pattern)
+	}
+	if root.segment {
+		return nil, errors.Errorf("pattern %s: segment variable outside a list", pattern)
+	}
+	return &Pattern{sexp: pattern, root: root}, nil
+}
+
+// ParsePattern parses the advanced representation of a pattern and
+// compiles it.  Unlike Parse, it permits ? in tokens, so that variables
+// need not be quoted.
+func ParsePattern(pattern string) (*Pattern, error) {
+	s, err := parsePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return CompilePattern(s)
+}
+
+// parsePattern parses pattern, which must consist of exactly one
+// S-expression, enforcing DefaultLimits.
+func parsePattern(pattern string) (Sexp, error) {
+	b := []byte(pattern)
+	p := &reader{r: bufio.NewReader(bytes.NewReader(b)), limits: DefaultLimits, patterns: true}
+	s, err := p.read()
+	if err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "pattern")
+	}
+	if rest := bytes.TrimSpace(b[p.n:]); len(rest) > 0 {
+		return nil, errors.Errorf("pattern: unexpected data after S-expression: %q", rest)
+	}
+	return s, nil
+}
+
+// MustParsePattern is like ParsePattern, but panics if the pattern
+// cannot be parsed.  It simplifies initialising global variables.
+func MustParsePattern(pattern string) *Pattern {
+	p, err := ParsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func compilePattern(s Sexp) (patternNode, error) {
+	switch s := s.(type) {
+	case Atom:
+		return compileAtom(s)
+	case List:
+		n := patternNode{kind: listNode, elements: make([]patternNode, len(s))}
+		for i, element := range s {
+			var err error
+			if n.elements[i], err = compilePattern(element); err != nil {
+				return n, err
+			}
+		}
+		return n, nil
+	}
+	return patternNode{}, errors.Errorf("can't compile %T", s)
+}
+
+func compileAtom(a Atom) (patternNode, error) {
+	v := a.Value
+	switch {
+	case !bytes.HasPrefix(v, []byte("?")):
+		return patternNode{kind: literalNode, literal: a}, nil
+	case bytes.HasPrefix(v, []byte("??")):
+		return patternNode{kind: literalNode, literal: Atom{DisplayHint: a.DisplayHint, Value: v[1:]}}, nil
+	}
+	n := patternNode{kind: variableNode, hint: a.DisplayHint}
+	v = v[1:]
+	if bytes.HasSuffix(v, []byte("...")) {
+		n.segment = true
+		v = v[:len(v)-len("...")]
+	}
+	if i := bytes.IndexByte(v, ':'); i > -1 {
+		switch string(v[i+1:]) {
+		case "atom":
+			n.constraint = atomConstraint
+		case "list":
+			n.constraint = listConstraint
+		default:
+			return n, errors.Errorf("variable %s: unknown constraint %q", a, v[i+1:])
+		}
+		v = v[:i]
+	}
+	if n.hint != nil && n.constraint == listConstraint {
+		return n, errors.Errorf("variable %s: a list has no display hint", a)
+	}
+	n.name = string(v)
+	return n, nil
+}
+
+// Sexp returns the S-expression from which p was compiled.
+func (p *Pattern) Sexp() Sexp {
+	return p.sexp
+}
+
+// String returns the advanced representation of p, in which atoms
+// beginning with ? are written as tokens, as ParsePattern reads them.
+func (p *Pattern) String() string {
+	buf := bytes.NewBuffer(nil)
+	writePattern(buf, p.sexp)
+	return buf.String()
+}
+
+func writePattern(buf *bytes.Buffer, s Sexp) {
+	switch s := s.(type) {
+	case Atom:
+		if !isPatternToken(s.Value) {
+			s.StringBuffer(buf)
+			return
+		}
+		if len(s.DisplayHint) > 0 {
+			buf.WriteString("[")
+			writeString(buf, s.DisplayHint)
+			buf.WriteString("]")
+		}
+		buf.Write(s.Value)
+	case List:
+		buf.WriteString("(")
+		for i, element := range s {
+			writePattern(buf, element)
+			if i < len(s)-1 {
+				buf.WriteString(" ")
+			}
+		}
+		buf.WriteString(")")
+	}
+}
+
+// isPatternToken reports whether v begins with ? and may be written as
+// a token in a pattern.
+func isPatternToken(v []byte) bool {
+	if len(v) == 0 || v[0] != '?' {
+		return false
+	}
+	for _, c := range v {
+		if c != '?' && bytes.IndexByte(tokenChar, c) == -1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Match reports whether s matches p, and if so returns the variables it
+// bound.
+func (p *Pattern) Match(s Sexp) (Bindings, bool) {
+	return p.root.match(s, Bindings{})
+}
+
+// match returns b extended with the bindings of n to s.  b is not
+// modified, so that it may be reused when backtracking.
+func (n *patternNode) match(s Sexp, b Bindings) (Bindings, bool) {
+	switch n.kind {
+	case literalNode:
+		return b, n.literal.Equal(s)
+	case variableNode:
+		if !n.accepts(s) {
+			return b, false
+		}
+		return b.bind(n.name, s)
+	}
+	l, ok := s.(List)
+	if !ok {
+		return b, false
+	}
+	return matchElements(n.elements, l, b)
+}
+
+// accepts reports whether s satisfies the constraints of the variable
+// n.
+func (n *patternNode) accepts(s Sexp) bool {
+	switch s := s.(type) {
+	case Atom:
+		return n.constraint != listConstraint && (n.hint == nil || bytes.Equal(n.hint, s.DisplayHint))
+	case List:
+		return n.constraint != atomConstraint && n.hint == nil
+	}
+	return false
+}
+
+func matchElements(patterns []patternNode, l List, b Bindings) (Bindings, bool) {
+	if len(patterns) == 0 {
+		return b, len(l) == 0
+	}
+	n := &patterns[0]
+	if !n.segment {
+		if len(l) == 0 {
+			return b, false
+		}
+		b, ok := n.match(l[0], b)
+		if !ok {
+			return b, false
+		}
+		return matchElements(patterns[1:], l[1:], b)
+	}
+	required := 0
+	for _, p := range patterns[1:] {
+		if !p.segment {
+			required++
+		}
+	}
+	for i := 0; i <= len(l)-required; i++ {
+		if i > 0 && !n.accepts(l[i-1]) {
+			break
+		}
+		segment := append(List{}, l[:i]...)
+		if bound, ok := b.bind(n.name, segment); ok {
+			if bound, ok = matchElements(patterns[1:], l[i:], bound); ok {
+				return bound, true
+			}
+		}
+	}
+	return b, false
+}
+
+// bind returns a copy of b in which name is bound to s, and whether
+// that is consistent with any existing binding of name.
+func (b Bindings) bind(name string, s Sexp) (Bindings, bool) {
+	if name == "" {
+		return b, true
+	}
+	if bound, ok := b[name]; ok {
+		return b, bound.Equal(s)
+	}
+	c := make(Bindings, len(b)+1)
+	for k, v := range b {
+		c[k] = v
+	}
+	c[name] = s
+	return c, true
+}
+
+// Instantiate returns a copy of p in which each variable is replaced by
+// its binding in b, and each segment variable by the elements of its
+// binding, which must be a List.  A variable with a display hint may be
+// bound to an atom without one, which acquires it.  Bindings are
+// substituted as they are, so that an atom such as ?x in b is never
+// itself taken for a variable; the result shares their storage.  It is
+// an error for a variable to be anonymous, unbound, or bound to an
+// S-expression it could not match.
+func (p *Pattern) Instantiate(b Bindings) (Sexp, error) {
+	s, err := p.root.instantiate(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "template %s", p.sexp)
+	}
+	return s, nil
+}
+
+// Instantiate compiles template as a pattern, and returns its
+// instantiation with b.
+func Instantiate(template Sexp, b Bindings) (Sexp, error) {
+	p, err := CompilePattern(template)
+	if err != nil {
+		return nil, err
+	}
+	return p.Instantiate(b)
+}
+
+func (n *patternNode) instantiate(b Bindings) (Sexp, error) {
+	switch n.kind {
+	case literalNode:
+		return n.literal, nil
+	case variableNode:
+		s, err := n.binding(b)
+		if err != nil {
+			return nil, err
+		}
+		return n.substitute(s)
+	}
+	l := make(List, 0, len(n.elements))
+	for i := range n.elements {
+		element := &n.elements[i]
+		if !element.segment {
+			s, err := element.instantiate(b)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, s)
+			continue
+		}
+		s, err := element.binding(b)
+		if err != nil {
+			return nil, err
+		}
+		segment, ok := s.(List)
+		if !ok {
+			return nil, errors.Errorf("segment variable %s bound to atom %s", element.name, s)
+		}
+		for _, s := range segment {
+			if s, err = element.substitute(s); err != nil {
+				return nil, err
+			}
+			l = append(l, s)
+		}
+	}
+	return l, nil
+}
+
+// binding returns the binding of the variable n in b.
+func (n *patternNode) binding(b Bindings) (Sexp, error) {
+	if n.name == "" {
+		return nil, errors.New("anonymous variable")
+	}
+	s, ok := b[n.name]
+	if !ok || s == nil {
+		return nil, errors.Errorf("variable %s unbound", n.name)
+	}
+	return s, nil
+}
+
+// substitute returns s, which must satisfy the constraints of the
+// variable n, giving it n's display hint if it has none.
+func (n *patternNode) substitute(s Sexp) (Sexp, error) {
+	if n.accepts(s) {
+		return s, nil
+	}
+	if a, ok := s.(Atom); ok && n.hint != nil && a.DisplayHint == nil && n.constraint != listConstraint {
+		return Atom{DisplayHint: n.hint, Value: a.Value}, nil
+	}
+	return nil, errors.Errorf("variable %s can't be bound to %s", n.name, s)
+}
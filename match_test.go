@@ -0,0 +1,228 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestPatternMatch(t *testing.T) {
+	for _, test := range []struct {
+		pattern, sexp string
+		expected      map[string]string // nil if no match
+	}{
+		{"?x", "foo", map[string]string{"x": "foo"}},
+		{"?x", "(a b)", map[string]string{"x": "(a b)"}},
+		{"?", "(a b)", map[string]string{}},
+		{"foo", "foo", map[string]string{}},
+		{"foo", "bar", nil},
+		{"foo", "[text]foo", nil},
+		{"[text]foo", "[text]foo", map[string]string{}},
+		{"[text]foo", "foo", nil},
+		{"??x", `"?x"`, map[string]string{}},
+		{"??x", "foo", nil},
+		{"(a ?x c)", "(a b c)", map[string]string{"x": "b"}},
+		{"(a ?x c)", "(a b c d)", nil},
+		{"(a ?x c)", "(a c)", nil},
+		{"?x:atom", "foo", map[string]string{"x": "foo"}},
+		{"?x:atom", "(foo)", nil},
+		{"?x:list", "(foo)", map[string]string{"x": "(foo)"}},
+		{"?x:list", "foo", nil},
+		{"[text/plain]?x", "[text/plain]foo", map[string]string{"x": "[text/plain]foo"}},
+		{"[text/plain]?x", "foo", nil},
+		{"[text/plain]?x", "(foo)", nil},
+		{"(?x ?x)", "(a a)", map[string]string{"x": "a"}},
+		{"(?x ?x)", "(a b)", nil},
+		{"(? ?)", "(a b)", map[string]string{}},
+		{"(a ?rest...)", "(a)", map[string]string{"rest": "()"}},
+		{"(a ?rest...)", "(a b (c))", map[string]string{"rest": "(b (c))"}},
+		{"(?x... ?y...)", "(a b)", map[string]string{"x": "()", "y": "(a b)"}},
+		{"(?x... c ?y...)", "(a b c d)", map[string]string{"x": "(a b)", "y": "(d)"}},
+		{"(?x... ?x...)", "(a b a b)", map[string]string{"x": "(a b)"}},
+		{"(?x... ?x...)", "(a b a)", nil},
+		{"(?x:atom... ?y...)", "(a b (c) d)", map[string]string{"x": "()", "y": "(a b (c) d)"}},
+		{"(?x:atom... (c) ?y...)", "(a b (c) d)", map[string]string{"x": "(a b)", "y": "(d)"}},
+		{"(?x:list...)", "((a) b)", nil},
+		{"(cert (issuer ?i) (subject ?s) ?rest...)", "(cert (issuer alice) (subject bob) (tag (*)) (comment hi))",
+			map[string]string{"i": "alice", "s": "bob", "rest": "((tag (*)) (comment hi))"}},
+		{"(cert (issuer ?i) (subject ?s) ?rest...)", "(cert (subject bob) (issuer alice))", nil},
+	} {
+		p, err := ParsePattern(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, ok := p.Match(parseString(t, test.sexp))
+		if ok != (test.expected != nil) {
+			t.Errorf("%s ~ %s: expected match %v", test.pattern, test.sexp, test.expected != nil)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if len(b) != len(test.expected) {
+			t.Errorf("%s ~ %s: expected %v; got %v", test.pattern, test.sexp, test.expected, b)
+		}
+		for name, expected := range test.expected {
+			if s, ok := b[name]; !ok || !s.Equal(parseString(t, expected)) {
+				t.Errorf("%s ~ %s: expected %s = %s; got %v", test.pattern, test.sexp, name, expected, s)
+			}
+		}
+	}
+}
+
+func TestCompilePatternErrors(t *testing.T) {
+	for _, pattern := range []string{"?x...", "?x:number", "[text]?x:list", "(a ?x:foo...)", "(a", "(a) b"} {
+		if _, err := ParsePattern(pattern); err == nil {
+			t.Errorf("%s: expected error", pattern)
+		}
+	}
+	if _, err := CompilePattern(nil); err == nil {
+		t.Error("nil pattern: expected error")
+	}
+}
+
+func TestPatternString(t *testing.T) {
+	for _, pattern := range []string{
+		"?x",
+		"(cert (issuer ?i) (subject ?s:list) ?rest...)",
+		"(a ? ?:atom ?... ??x [text/plain]?body)",
+		`(a "b c" |AQ==| ?x:atom...)`,
+	} {
+		p := MustParsePattern(pattern)
+		if p.String() != pattern {
+			t.Errorf("%s: String returned %s", pattern, p.String())
+		}
+		q, err := ParsePattern(p.String())
+		if err != nil {
+			t.Errorf("%s: %v", pattern, err)
+			continue
+		}
+		if !q.Sexp().Equal(p.Sexp()) {
+			t.Errorf("%s: round-tripped to %s", pattern, q)
+		}
+	}
+	// a variable whose name can't be a token is written otherwise
+	p, err := CompilePattern(List{Atom{Value: []byte("?a b")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q, err := ParsePattern(p.String()); err != nil || !q.Sexp().Equal(p.Sexp()) {
+		t.Errorf("%s round-tripped to %v, %v", p, q, err)
+	}
+}
+
+func parseString(t *testing.T, s string) Sexp {
+	sexp, _, err := Parse([]byte(s))
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return sexp
+}
+
+func ExamplePattern() {
+	p := MustParsePattern("(cert (issuer ?i) (subject ?s) ?rest...)")
+	s, _, err := Parse([]byte("(cert (issuer alice) (subject bob) (tag (*)))"))
+	if err != nil {
+		panic(err)
+	}
+	b, ok := p.Match(s)
+	var names []string
+	for name := range b {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name, b[name].String())
+	}
+	fmt.Println(ok)
+	// Output:
+	// i alice
+	// rest ((tag (*)))
+	// s bob
+	// true
+}
+
+func TestInstantiate(t *testing.T) {
+	b := Bindings{
+		"i":     parseString(t, "alice"),
+		"s":     parseString(t, "(hash sha256 #01#)"),
+		"rest":  parseString(t, "((tag (*)) (comment hi))"),
+		"none":  List{},
+		"body":  parseString(t, `"hello"`),
+		"typed": parseString(t, "[image/png]#89#"),
+		"var":   parseString(t, `"?i"`),
+	}
+	for _, test := range []struct {
+		template, expected string
+	}{
+		{"?i", "alice"},
+		{"(cert (issuer ?i) (subject ?s) ?rest...)", "(cert (issuer alice) (subject (hash sha256 #01#)) (tag (*)) (comment hi))"},
+		{"(a ?none... b)", "(a b)"},
+		{"(a ?i ?i)", "(a alice alice)"},
+		{"(text [text/plain]?body)", `(text [text/plain]"hello")`},
+		{"(image [image/png]?typed)", "(image [image/png]#89#)"},
+		{"(literal ??i)", `(literal "?i")`},
+		// atom contents are never taken for variables
+		{"(quoted ?var)", `(quoted "?i")`},
+		{"(?i:atom ?s:list ?rest:list...)", "(alice (hash sha256 #01#) (tag (*)) (comment hi))"},
+	} {
+		p, err := ParsePattern(test.template)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := p.Instantiate(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.template, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.expected)) {
+			t.Errorf("%s: expected %s; got %s", test.template, test.expected, s)
+		}
+		// matching the result recovers the bindings used, but for body,
+		// which acquires a display hint
+		matched, ok := p.Match(s)
+		if !ok {
+			t.Errorf("%s: %s does not match", test.template, s)
+		}
+		for name, bound := range matched {
+			if expected := b[name]; !bound.Equal(expected) && name != "body" {
+				t.Errorf("%s: expected %s = %s; got %s", test.template, name, expected, bound)
+			}
+		}
+	}
+}
+
+func TestInstantiateErrors(t *testing.T) {
+	b := Bindings{
+		"atom":  parseString(t, "a"),
+		"list":  parseString(t, "(a b)"),
+		"typed": parseString(t, "[text/plain]a"),
+	}
+	for _, template := range []string{
+		"?",
+		"?unbound",
+		"(a ?unbound...)",
+		"(a ?atom...)",
+		"?list:atom",
+		"?atom:list",
+		"(?list:list...)",
+		"[image/png]?typed",
+		"[image/png]?list",
+	} {
+		if s, err := Instantiate(parseTemplate(t, template), b); err == nil {
+			t.Errorf("%s: expected error; got %s", template, s)
+		}
+	}
+}
+
+func parseTemplate(t *testing.T, s string) Sexp {
+	p, err := ParsePattern(s)
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return p.Sexp()
+}
@@ -0,0 +1,247 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"strconv"
+)
+
+// A Merger merges concurrent edits of an S-expression.  The zero
+// Merger merges every list by position.
+type Merger struct {
+	// Keyed lists the heads of lists whose elements are unordered
+	// and identified by their own heads, e.g. config for
+	// (config (port "80") (host example.com)).  A keyed list is
+	// merged by position instead if any version of it has an element
+	// which is not a list headed by an atom, or two elements with the
+	// same head.
+	Keyed []string
+}
+
+// A Conflict records an element edited differently by ours and
+// theirs.  Path addresses the element in the merged result, which
+// takes ours.  Base, Ours and Theirs are the element's versions, nil
+// where it is absent, e.g. having been deleted.  Where both inserted
+// different elements into the same place in a list, Base is nil and
+// Ours and Theirs are Lists of the elements each inserted.
+type Conflict struct {
+	Path               []int
+	Base, Ours, Theirs Sexp
+}
+
+// Merge merges base, ours and theirs with the zero Merger.
+func Merge(base, ours, theirs Sexp) (Sexp, []Conflict) {
+	return Merger{}.Merge(base, ours, theirs)
+}
+
+// Merge returns the three-way merge of ours and theirs, each edited
+// from base, and any conflicts between them.  An element changed by
+// only one of ours and theirs, or identically by both, is merged
+// without conflict; lists changed by both are merged element by
+// element, aligning them with base as Diff does, or by head if keyed.
+// Any of base, ours and theirs may be nil, meaning that it is absent:
+// e.g. ours is nil if it deleted base, and base is nil if ours and
+// theirs were each created independently.
+func (m Merger) Merge(base, ours, theirs Sexp) (Sexp, []Conflict) {
+	return m.merge(base, ours, theirs, []int{}, nil)
+}
+
+func (m Merger) merge(base, ours, theirs Sexp, path []int, conflicts []Conflict) (Sexp, []Conflict) {
+	switch {
+	case equal(ours, theirs), equal(base, theirs):
+		return ours, conflicts
+	case equal(base, ours):
+		return theirs, conflicts
+	}
+	b, bIsList := base.(List)
+	o, oIsList := ours.(List)
+	t, tIsList := theirs.(List)
+	if !bIsList || !oIsList || !tIsList {
+		return ours, append(conflicts, Conflict{Path: path, Base: base, Ours: ours, Theirs: theirs})
+	}
+	if m.keyed(b, o, t) {
+		return m.mergeKeyed(b, o, t, path, conflicts)
+	}
+	return m.mergeOrdered(b, o, t, path, conflicts)
+}
+
+// keyed reports whether lists is a keyed list in every version.
+func (m Merger) keyed(lists ...List) bool {
+	h, ok := head(lists[0])
+	if !ok {
+		return false
+	}
+	found := false
+	for _, k := range m.Keyed {
+		if k == string(h) {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+	for _, l := range lists {
+		if lh, ok := head(l); !ok || string(lh) != string(h) {
+			return false
+		}
+		if _, ok := elementKeys(l); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// elementKeys returns the index in l of each element, by its head, and
+// whether each is a list with a distinct head.
+func elementKeys(l List) (map[string]int, bool) {
+	keys := make(map[string]int, len(l)-1)
+	for i, element := range l[1:] {
+		h, ok := head(element)
+		if !ok {
+			return nil, false
+		}
+		if _, duplicate := keys[string(h)]; duplicate {
+			return nil, false
+		}
+		keys[string(h)] = i + 1
+	}
+	return keys, true
+}
+
+// mergeKeyed merges keyed lists.  The elements of ours come first, in
+// their order, followed by those added by theirs.
+func (m Merger) mergeKeyed(base, ours, theirs List, path []int, conflicts []Conflict) (Sexp, []Conflict) {
+	baseKeys, _ := elementKeys(base)
+	ourKeys, _ := elementKeys(ours)
+	theirKeys, _ := elementKeys(theirs)
+	result := List{ours[0]}
+	for _, o := range ours[1:] {
+		h, _ := head(o)
+		b, inBase := baseKeys[string(h)]
+		t, inTheirs := theirKeys[string(h)]
+		elementPath := appendPath(path, len(result))
+		switch {
+		case inTheirs && inBase:
+			var merged Sexp
+			merged, conflicts = m.merge(base[b], o, theirs[t], elementPath, conflicts)
+			result = append(result, merged)
+		case inTheirs:
+			// added by both
+			if !o.Equal(theirs[t]) {
+				conflicts = append(conflicts, Conflict{Path: elementPath, Ours: o, Theirs: theirs[t]})
+			}
+			result = append(result, o)
+		case inBase:
+			// deleted by theirs
+			if !o.Equal(base[b]) {
+				conflicts = append(conflicts, Conflict{Path: elementPath, Base: base[b], Ours: o})
+				result = append(result, o)
+			}
+		default:
+			// added by ours
+			result = append(result, o)
+		}
+	}
+	for _, t := range theirs[1:] {
+		h, _ := head(t)
+		if _, inOurs := ourKeys[string(h)]; inOurs {
+			continue
+		}
+		b, inBase := baseKeys[string(h)]
+		switch {
+		case !inBase:
+			// added by theirs
+			result = append(result, t)
+		case !t.Equal(base[b]):
+			// deleted by ours, but edited by theirs
+			conflicts = append(conflicts, Conflict{Path: appendPath(path, len(result)), Base: base[b], Theirs: t})
+		}
+	}
+	return result, conflicts
+}
+
+// mergeOrdered merges lists by position, after the manner of diff3.
+func (m Merger) mergeOrdered(base, ours, theirs List, path []int, conflicts []Conflict) (Sexp, []Conflict) {
+	ourMatches, ourInserts := counterparts(base, ours)
+	theirMatches, theirInserts := counterparts(base, theirs)
+	var result List
+	for i := 0; i <= len(base); i++ {
+		o, t := ourInserts[i], theirInserts[i]
+		switch {
+		case len(t) == 0 || o.Equal(t):
+			result = append(result, o...)
+		case len(o) == 0:
+			result = append(result, t...)
+		default:
+			conflicts = append(conflicts, Conflict{Path: appendPath(path, len(result)), Ours: o, Theirs: t})
+			result = append(result, o...)
+		}
+		if i == len(base) {
+			break
+		}
+		elementPath := appendPath(path, len(result))
+		oi, ti := ourMatches[i], theirMatches[i]
+		switch {
+		case oi == -1 && ti == -1:
+			// deleted by both
+		case oi == -1:
+			if !theirs[ti].Equal(base[i]) {
+				conflicts = append(conflicts, Conflict{Path: elementPath, Base: base[i], Theirs: theirs[ti]})
+			}
+		case ti == -1:
+			if !ours[oi].Equal(base[i]) {
+				conflicts = append(conflicts, Conflict{Path: elementPath, Base: base[i], Ours: ours[oi]})
+				result = append(result, ours[oi])
+			}
+		default:
+			var merged Sexp
+			merged, conflicts = m.merge(base[i], ours[oi], theirs[ti], elementPath, conflicts)
+			result = append(result, merged)
+		}
+	}
+	if result == nil {
+		result = List{}
+	}
+	return result, conflicts
+}
+
+// counterparts aligns base with edited, returning for each element of
+// base the index of its counterpart in edited, or -1 if it was
+// deleted, and the elements inserted before each element of base, and
+// after the last.
+func counterparts(base, edited List) ([]int, []List) {
+	matches := make([]int, len(base))
+	inserts := make([]List, len(base)+1)
+	next := 0
+	for _, pair := range align(base, edited) {
+		if pair.i == -1 {
+			inserts[next] = append(inserts[next], edited[pair.j])
+			continue
+		}
+		matches[pair.i] = pair.j
+		next = pair.i + 1
+	}
+	return matches, inserts
+}
+
+// MarshalSexp implements Marshaler, encoding c as e.g.:
+//    (conflict (path "1") (base "80") (ours "8080") (theirs "8000"))
+// Absent versions are omitted.
+func (c Conflict) MarshalSexp() (Sexp, error) {
+	path := List{Atom{Value: []byte("path")}}
+	for _, i := range c.Path {
+		path = append(path, Atom{Value: []byte(strconv.Itoa(i))})
+	}
+	l := List{Atom{Value: []byte("conflict")}, path}
+	for _, version := range []struct {
+		name string
+		s    Sexp
+	}{{"base", c.Base}, {"ours", c.Ours}, {"theirs", c.Theirs}} {
+		if version.s != nil {
+			l = append(l, List{Atom{Value: []byte(version.name)}, version.s})
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	for _, test := range []struct {
+		base, ours, theirs, expected string
+		conflicts                    []string
+	}{
+		{"a", "a", "a", "a", nil},
+		{"a", "b", "a", "b", nil},
+		{"a", "a", "b", "b", nil},
+		{"a", "b", "b", "b", nil},
+		{"a", "b", "c", "b", []string{`(conflict (path) (base a) (ours b) (theirs c))`}},
+		{"a", "[text]a", "b", "[text]a", []string{`(conflict (path) (base a) (ours [text]a) (theirs b))`}},
+		{"(a b c)", "(x b c)", "(a b y)", "(x b y)", nil},
+		{"(a b c)", "(a b c d)", "(z a b c)", "(z a b c d)", nil},
+		{"(a b c)", "(a c)", "(a b c d)", "(a c d)", nil},
+		{"(a b c)", "(a c)", "(a c)", "(a c)", nil},
+		{"(a b c)", "(a c)", "(a x c)", "(a c)", []string{`(conflict (path "1") (base b) (theirs x))`}},
+		{"(a b c)", "(a x c)", "(a c)", "(a x c)", []string{`(conflict (path "1") (base b) (ours x))`}},
+		{"(a b)", "(a x b)", "(a y b)", "(a x b)", []string{`(conflict (path "1") (ours (x)) (theirs (y)))`}},
+		{"(a b)", "(a x b)", "(a x b)", "(a x b)", nil},
+		{"(config (port \"80\") (host a))", "(config (port \"8080\") (host a))", "(config (port \"80\") (host b))",
+			"(config (port \"8080\") (host b))", nil},
+		{"(config (port \"80\") (host a))", "(config (port \"8080\") (host a))", "(config (port \"8000\") (host a))",
+			"(config (port \"8080\") (host a))", []string{`(conflict (path "1" "1") (base "80") (ours "8080") (theirs "8000"))`}},
+		// ordered lists are aligned by position, so reordering conflicts with editing
+		{"(list (a \"1\") (b \"2\"))", "(list (b \"2\") (a \"1\"))", "(list (a \"2\") (b \"2\"))",
+			"(list (b \"2\") (a \"1\"))", []string{`(conflict (path "1") (base (a "1")) (theirs (a "2")))`}},
+		// but keyed lists are aligned by head
+		{"(config (a \"1\") (b \"2\"))", "(config (b \"2\") (a \"1\"))", "(config (a \"2\") (b \"2\"))",
+			"(config (b \"2\") (a \"2\"))", nil},
+		{"(config (a \"1\") (b \"2\"))", "(config (a \"1\") (b \"2\") (c \"3\"))", "(config (d \"4\") (a \"1\") (b \"2\"))",
+			"(config (a \"1\") (b \"2\") (c \"3\") (d \"4\"))", nil},
+		{"(config (a \"1\") (b \"2\"))", "(config (a \"1\"))", "(config (a \"2\") (b \"2\"))", "(config (a \"2\"))", nil},
+		{"(config (a \"1\") (b \"2\"))", "(config (a \"1\"))", "(config (a \"1\") (b \"3\"))",
+			"(config (a \"1\"))", []string{`(conflict (path "2") (base (b "2")) (theirs (b "3")))`}},
+		{"(config (a \"1\"))", "(config (a \"1\") (b \"2\"))", "(config (a \"1\") (b \"3\"))",
+			"(config (a \"1\") (b \"2\"))", []string{`(conflict (path "2") (ours (b "2")) (theirs (b "3")))`}},
+		// duplicate heads cause a keyed list to be merged by position
+		{"(config (a \"1\") (a \"2\"))", "(config (a \"1\") (a \"2\") (b \"3\"))", "(config (a \"0\") (a \"2\"))",
+			"(config (a \"0\") (a \"2\") (b \"3\"))", nil},
+	} {
+		m := Merger{Keyed: []string{"config"}}
+		result, conflicts := m.Merge(parseString(t, test.base), parseString(t, test.ours), parseString(t, test.theirs))
+		if !result.Equal(parseString(t, test.expected)) {
+			t.Errorf("%s, %s, %s: expected %s; got %s", test.base, test.ours, test.theirs, test.expected, result)
+		}
+		var got []string
+		for _, c := range conflicts {
+			s, err := c.MarshalSexp()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, s.String())
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.conflicts) {
+			t.Errorf("%s, %s, %s: expected conflicts %v; got %v", test.base, test.ours, test.theirs, test.conflicts, got)
+		}
+	}
+}
+
+func TestMergeAbsent(t *testing.T) {
+	a, b := parseString(t, "(a b)"), parseString(t, "(a c)")
+	for _, test := range []struct {
+		base, ours, theirs, expected Sexp
+		conflict                     bool
+	}{
+		{nil, nil, nil, nil, false},
+		{nil, a, nil, a, false},
+		{nil, nil, a, a, false},
+		{nil, a, a, a, false},
+		{nil, a, b, a, true},
+		{a, nil, a, nil, false},
+		{a, a, nil, nil, false},
+		{a, nil, nil, nil, false},
+		{a, nil, b, nil, true},
+		{a, b, nil, b, true},
+	} {
+		result, conflicts := Merge(test.base, test.ours, test.theirs)
+		if !equal(result, test.expected) {
+			t.Errorf("%v, %v, %v: expected %v; got %v", test.base, test.ours, test.theirs, test.expected, result)
+		}
+		if (len(conflicts) > 0) != test.conflict {
+			t.Errorf("%v, %v, %v: got conflicts %v", test.base, test.ours, test.theirs, conflicts)
+		}
+		for _, c := range conflicts {
+			if !equal(c.Base, test.base) || !equal(c.Ours, test.ours) || !equal(c.Theirs, test.theirs) {
+				t.Errorf("%v, %v, %v: got conflict %v", test.base, test.ours, test.theirs, c)
+			}
+		}
+	}
+}
+
+func ExampleMerger() {
+	base, _, _ := Parse([]byte(`(config (port "80") (host a.example.com))`))
+	ours, _, _ := Parse([]byte(`(config (port "8080") (host a.example.com))`))
+	theirs, _, _ := Parse([]byte(`(config (host b.example.com) (user www))`))
+	result, conflicts := Merger{Keyed: []string{"config"}}.Merge(base, ours, theirs)
+	fmt.Println(result.String())
+	for _, c := range conflicts {
+		s, _ := c.MarshalSexp()
+		fmt.Println(s.String())
+	}
+	// Output:
+	// (config (port "8080") (host b.example.com) (user www))
+	// (conflict (path "1") (base (port "80")) (ours (port "8080")))
+}
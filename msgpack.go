@@ -0,0 +1,213 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ToMsgPack returns the MessagePack encoding of s.  An atom is encoded
+// as a bin, unless it has a display hint, when it is encoded as a map
+// of one entry, from its hint to its value, both bins.  A list is
+// encoded as an array of its elements.  The encoding is deterministic:
+// each length is encoded in the shortest form possible.  No atom may
+// be longer, nor list have more elements, than 2^32-1.
+func ToMsgPack(s Sexp) ([]byte, error) {
+	return appendMsgPack(nil, s)
+}
+
+func appendMsgPack(b []byte, s Sexp) ([]byte, error) {
+	var err error
+	switch s := s.(type) {
+	case Atom:
+		if len(s.DisplayHint) > 0 {
+			if b, err = appendMsgPackBin(append(b, 0x81), s.DisplayHint); err != nil {
+				return nil, err
+			}
+		}
+		return appendMsgPackBin(b, s.Value)
+	case List:
+		n := uint64(len(s))
+		switch {
+		case n < 16:
+			b = append(b, 0x90|byte(n))
+		case n <= 0xffff:
+			b = appendBigEndian(append(b, 0xdc), n, 2)
+		case n <= 0xffffffff:
+			b = appendBigEndian(append(b, 0xdd), n, 4)
+		default:
+			return nil, errors.Errorf("list of %d elements too long for MessagePack", n)
+		}
+		for _, element := range s {
+			if b, err = appendMsgPack(b, element); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, errors.Errorf("can't encode %T as MessagePack", s)
+}
+
+func appendMsgPackBin(b, v []byte) ([]byte, error) {
+	n := uint64(len(v))
+	switch {
+	case n <= 0xff:
+		b = append(b, 0xc4, byte(n))
+	case n <= 0xffff:
+		b = appendBigEndian(append(b, 0xc5), n, 2)
+	case n <= 0xffffffff:
+		b = appendBigEndian(append(b, 0xc6), n, 4)
+	default:
+		return nil, errors.Errorf("atom of %d bytes too long for MessagePack", n)
+	}
+	return append(b, v...), nil
+}
+
+// FromMsgPack decodes the MessagePack encoding of an S-expression, as
+// returned by ToMsgPack, which must be all of b.  Strs are accepted as
+// atoms, and non-deterministic lengths are tolerated, but other types
+// are not.  Lists may be nested no more deeply than DefaultLimits
+// permits.
+func FromMsgPack(b []byte) (Sexp, error) {
+	d := &msgPackDecoder{b: b, n: len(b)}
+	s, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if len(d.b) > 0 {
+		return nil, d.errorf("unexpected data after S-expression")
+	}
+	return s, nil
+}
+
+type msgPackDecoder struct {
+	b     []byte // the remaining input
+	n     int    // the length of the whole input
+	depth int
+}
+
+func (d *msgPackDecoder) errorf(format string, args ...interface{}) error {
+	return errors.Wrapf(errors.Errorf(format, args...), "MessagePack: offset %d", d.n-len(d.b))
+}
+
+// eof reports that the input ends within an object.
+func (d *msgPackDecoder) eof() error {
+	return errors.Wrapf(io.ErrUnexpectedEOF, "MessagePack: offset %d", d.n)
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgPackDecoder) uint(size int) (uint64, error) {
+	if len(d.b) < size {
+		return 0, d.eof()
+	}
+	var n uint64
+	for _, c := range d.b[:size] {
+		n = n<<8 | uint64(c)
+	}
+	d.b = d.b[size:]
+	return n, nil
+}
+
+func (d *msgPackDecoder) decode() (Sexp, error) {
+	if len(d.b) == 0 {
+		return nil, d.eof()
+	}
+	c := d.b[0]
+	if c == 0x81 {
+		// a map of one entry is a hinted atom
+		d.b = d.b[1:]
+		hint, err := d.atom()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.atom()
+		if err != nil {
+			return nil, err
+		}
+		if len(hint) == 0 {
+			return nil, d.errorf("empty display hint")
+		}
+		return Atom{DisplayHint: hint, Value: value}, nil
+	}
+	var (
+		n   uint64
+		err error
+	)
+	switch {
+	case c&0xf0 == 0x90:
+		n = uint64(c & 0x0f)
+		d.b = d.b[1:]
+	case c == 0xdc:
+		d.b = d.b[1:]
+		n, err = d.uint(2)
+	case c == 0xdd:
+		d.b = d.b[1:]
+		n, err = d.uint(4)
+	default:
+		value, err := d.atom()
+		if err != nil {
+			return nil, err
+		}
+		return Atom{Value: value}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// each element occupies at least a byte
+	if n > uint64(len(d.b)) {
+		return nil, d.eof()
+	}
+	if max := DefaultLimits.MaxDepth; max > 0 && d.depth >= max {
+		return nil, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	l := List{}
+	for i := uint64(0); i < n; i++ {
+		element, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, element)
+	}
+	return l, nil
+}
+
+// atom reads a bin or str.
+func (d *msgPackDecoder) atom() ([]byte, error) {
+	if len(d.b) == 0 {
+		return nil, d.eof()
+	}
+	c := d.b[0]
+	var size int
+	switch {
+	case c&0xe0 == 0xa0:
+		// fixstr
+	case c == 0xc4 || c == 0xd9:
+		size = 1
+	case c == 0xc5 || c == 0xda:
+		size = 2
+	case c == 0xc6 || c == 0xdb:
+		size = 4
+	default:
+		return nil, d.errorf("unsupported type %#02x", c)
+	}
+	d.b = d.b[1:]
+	n := uint64(c & 0x1f)
+	if size > 0 {
+		var err error
+		if n, err = d.uint(size); err != nil {
+			return nil, err
+		}
+	}
+	if n > uint64(len(d.b)) {
+		return nil, d.eof()
+	}
+	value := append([]byte{}, d.b[:n]...)
+	d.b = d.b[n:]
+	return value, nil
+}
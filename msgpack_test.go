@@ -0,0 +1,92 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMsgPack(t *testing.T) {
+	for _, test := range []struct {
+		sexp, msgpack string // msgpack in hexadecimal
+	}{
+		{`""`, "c400"},
+		{"foo", "c403666f6f"},
+		{"()", "90"},
+		{"(a (b) ())", "93c40161" + "91c40162" + "90"},
+		{"[h]a", "81c40168c40161"},
+		{"(a b c d e f g h i j k l m n o p)", "dc0010" + "c40161c40162c40163c40164c40165c40166c40167c40168" +
+			"c40169c4016ac4016bc4016cc4016dc4016ec4016fc40170"},
+		{`|` + strings.Repeat("A", 344) + `|`, "c50102" + strings.Repeat("00", 258)},
+	} {
+		s := parseString(t, test.sexp)
+		b, err := ToMsgPack(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(b) != test.msgpack {
+			t.Errorf("%s: expected %s; got %x", test.sexp, test.msgpack, b)
+		}
+		result, err := FromMsgPack(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.sexp, err)
+			continue
+		}
+		if !bytes.Equal(result.Pack(), s.Pack()) {
+			t.Errorf("%s: decoded as %s", test.sexp, result)
+		}
+	}
+}
+
+func TestFromMsgPack(t *testing.T) {
+	for _, test := range []struct {
+		msgpack, sexp string
+	}{
+		{"a3666f6f", "foo"},
+		{"d903666f6f", "foo"},
+		{"dd00000000", "()"},
+		{"81a168a161", "[h]a"},
+	} {
+		b, _ := hex.DecodeString(test.msgpack)
+		s, err := FromMsgPack(b)
+		if err != nil {
+			t.Errorf("%s: %v", test.msgpack, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.sexp)) {
+			t.Errorf("%s: expected %s; got %s", test.msgpack, test.sexp, s)
+		}
+	}
+	for _, test := range []struct {
+		msgpack string
+		err     error
+	}{
+		{"", io.ErrUnexpectedEOF},
+		{"c403666f", io.ErrUnexpectedEOF},
+		{"92", io.ErrUnexpectedEOF},
+		{"ddffffffff", io.ErrUnexpectedEOF},
+		{"c6ffff", io.ErrUnexpectedEOF},
+		{"81c40168", io.ErrUnexpectedEOF},
+		{"01", nil},
+		{"c0", nil},
+		{"80", nil},
+		{"82c40161c40162c40163c40164", nil},
+		{"81c400c40161", nil},
+		{"8190c40161", nil},
+		{"c40161c40162", nil},
+		{strings.Repeat("91", 1025) + "90", ErrLimitExceeded},
+	} {
+		b, _ := hex.DecodeString(test.msgpack)
+		s, err := FromMsgPack(b)
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%s: expected error %v; got %v, %v", test.msgpack, test.err, s, err)
+		}
+	}
+}
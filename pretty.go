@@ -0,0 +1,127 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+)
+
+// A Printer writes the advanced representation of an S-expression
+// across multiple lines, indenting nested lists.  Its output may be
+// read back with Read.
+type Printer struct {
+	// Indent is the number of spaces by which the elements of a
+	// broken list are indented relative to its opening parenthesis.
+	Indent int
+
+	// Width is the maximum line width the Printer aims for.  Atoms
+	// which are wider than Width on their own are never broken.  A
+	// Width of zero means that every list is broken.
+	Width int
+
+	// KeepShort, if true, prints a list on a single line whenever it
+	// fits within Width.
+	KeepShort bool
+
+	// AlignTails, if true, prints the first element after an atom at
+	// the head of a broken list on the same line as the head, and
+	// aligns the following elements under it.
+	AlignTails bool
+}
+
+// DefaultPrinter is a Printer with reasonable settings for display.
+var DefaultPrinter = &Printer{Indent: 2, Width: 80, KeepShort: true}
+
+// Sprint returns the pretty-printed advanced representation of s.
+func (p *Printer) Sprint(s Sexp) string {
+	buf := bytes.NewBuffer(nil)
+	p.Fprint(buf, s)
+	return buf.String()
+}
+
+// Fprint writes the pretty-printed advanced representation of s to w,
+// with no trailing newline, returning the first write error
+// encountered.
+func (p *Printer) Fprint(w io.Writer, s Sexp) error {
+	bw := bufio.NewWriter(w)
+	p.print(bw, s, 0, 0)
+	return bw.Flush()
+}
+
+// print writes s to w, assuming that the cursor is at column col and
+// that s will be followed on the same line by trail closing
+// parentheses.  It returns the column at which the cursor is left.
+func (p *Printer) print(w *bufio.Writer, s Sexp, col, trail int) int {
+	l, ok := s.(List)
+	if !ok {
+		str := s.String()
+		w.WriteString(str)
+		return col + len(str)
+	}
+	if p.KeepShort {
+		if width, fits := flatWidth(l, p.Width-col-trail); fits {
+			writeAdvanced(w, l)
+			return col + width
+		}
+	}
+	w.WriteByte('(')
+	if len(l) == 0 {
+		w.WriteByte(')')
+		return col + 2
+	}
+	tail := l[1:]
+	end := p.print(w, l[0], col+1, closers(tail, trail))
+	indent := col + p.Indent
+	if _, isAtom := l[0].(Atom); p.AlignTails && isAtom && len(tail) > 0 {
+		w.WriteByte(' ')
+		indent = end + 1
+		tail0 := tail[0]
+		tail = tail[1:]
+		end = p.print(w, tail0, indent, closers(tail, trail))
+	}
+	for i, datum := range tail {
+		w.WriteByte('\n')
+		w.WriteString(strings.Repeat(" ", indent))
+		end = p.print(w, datum, indent, closers(tail[i+1:], trail))
+	}
+	w.WriteByte(')')
+	return end + 1
+}
+
+// closers returns the number of closing parentheses which follow an
+// element on its line: those of the enclosing lists if it is the last
+// element of its own list, and none otherwise.
+func closers(following List, trail int) int {
+	if len(following) > 0 {
+		return 0
+	}
+	return trail + 1
+}
+
+// flatWidth returns the width of the single-line advanced
+// representation of s, and whether that width is no more than limit.
+// It stops measuring once the limit is exceeded.
+func flatWidth(s Sexp, limit int) (width int, fits bool) {
+	l, ok := s.(List)
+	if !ok {
+		width = len(s.String())
+		return width, width <= limit
+	}
+	width = 2 // ()
+	if len(l) > 0 {
+		width += len(l) - 1 // spaces
+	}
+	for _, datum := range l {
+		if width > limit {
+			return width, false
+		}
+		w, _ := flatWidth(datum, limit-width)
+		width += w
+	}
+	return width, width <= limit
+}
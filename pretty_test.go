@@ -0,0 +1,76 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"fmt"
+	"testing"
+)
+
+const prettyTestCert = `(cert (issuer (hash md5 |Ga/9FBeRaxKPdxhC+3QZjw==|))
+ (subject (ref alice mother)) (tag (ftp cybercash.com cme))
+ (valid (not-before "1997-01-01_00:00:00") (not-after "1998-01-01_00:00:00"))
+ [text/plain]"a\nmultiline\tcomment" "1234" ())`
+
+func TestPrinterRoundTrip(t *testing.T) {
+	s, _, err := Parse([]byte(prettyTestCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Printer{
+		DefaultPrinter,
+		{Indent: 1, Width: 0},
+		{Indent: 4, Width: 20, KeepShort: true},
+		{Indent: 2, Width: 40, KeepShort: true, AlignTails: true},
+	} {
+		str := p.Sprint(s)
+		parsed, _, err := Parse([]byte(str))
+		if err != nil {
+			t.Fatalf("%+v: %v in\n%s", p, err, str)
+		}
+		if !parsed.Equal(s) {
+			t.Fatalf("%+v: round trip produced %v", p, parsed)
+		}
+	}
+}
+
+func TestPrinterWidth(t *testing.T) {
+	s, _, err := Parse([]byte(prettyTestCert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &Printer{Indent: 2, Width: 60, KeepShort: true}
+	col := 0
+	for _, c := range p.Sprint(s) {
+		if c == '\n' {
+			col = 0
+			continue
+		}
+		col++
+		if col > p.Width {
+			t.Fatalf("line exceeds %d columns:\n%s", p.Width, p.Sprint(s))
+		}
+	}
+}
+
+func ExamplePrinter() {
+	s, _, err := Parse([]byte("(cert (issuer alice) (subject (ref bob carol)) (tag (*)))"))
+	if err != nil {
+		panic(err)
+	}
+	p := &Printer{Indent: 2, Width: 28, KeepShort: true}
+	fmt.Println(p.Sprint(s))
+	p.AlignTails = true
+	fmt.Println(p.Sprint(s))
+	// Output:
+	// (cert
+	//   (issuer alice)
+	//   (subject (ref bob carol))
+	//   (tag (*)))
+	// (cert (issuer alice)
+	//       (subject (ref bob
+	//                     carol))
+	//       (tag (*)))
+}
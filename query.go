@@ -0,0 +1,284 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// A Query selects subexpressions of an S-expression, in the manner of
+// XPath.  A query is a sequence of steps, each preceded by / to select
+// among the children of the expressions selected by the previous step,
+// or by // to select among all their descendants.  The children of a
+// list are its elements, excluding an atom at its head, which is
+// regarded as its name; the first step selects from the root itself.
+// A step is one of:
+//
+//    name     lists whose head is the atom name
+//    *        any S-expression
+//
+// followed by any number of predicates, applied in turn:
+//
+//    [n]            replaces each list with its element n, counting
+//                   its head as element 0
+//    [head=name]    keeps only lists whose head is the atom name
+//    [hint=hint]    keeps only atoms with the display hint hint
+//
+// For example, given (cert (issuer ...) (subject (ref alice mother))),
+// the query /cert/subject/ref[1] selects alice, and //ref selects
+// (ref alice mother).
+type Query struct {
+	source string
+	steps  []queryStep
+}
+
+type queryStep struct {
+	descendants bool   // preceded by //
+	name        []byte // nil for *
+	predicates  []queryPredicate
+}
+
+type queryPredicate struct {
+	index int    // if kind is indexPredicate
+	kind  int    // one of the constants below
+	value []byte // if kind is headPredicate or hintPredicate
+}
+
+const (
+	indexPredicate = iota
+	headPredicate
+	hintPredicate
+)
+
+// A Match is an S-expression selected by a Query, together with its
+// path: the indices of the successive lists containing it, starting
+// from the root, as used by MerkleTree.
+type Match struct {
+	Sexp Sexp
+	Path []int
+}
+
+// CompileQuery parses a query, so that it may be used with Select.
+func CompileQuery(query string) (*Query, error) {
+	q := &Query{source: query}
+	s := []byte(query)
+	i := 0
+	fail := func(format string, args ...interface{}) (*Query, error) {
+		return nil, errors.Errorf("query %q: offset %d: "+format, append([]interface{}{query, i}, args...)...)
+	}
+	if len(s) == 0 {
+		return fail("empty query")
+	}
+	for i < len(s) {
+		var step queryStep
+		if s[i] != '/' {
+			return fail("expected '/'; found %q", s[i])
+		}
+		i++
+		if i < len(s) && s[i] == '/' {
+			step.descendants = true
+			i++
+		}
+		switch {
+		case i < len(s) && s[i] == '*':
+			i++
+		default:
+			start := i
+			for i < len(s) && isQueryNameChar(s[i]) {
+				i++
+			}
+			if i == start {
+				if i == len(s) {
+					return fail("expected name or '*'")
+				}
+				return fail("expected name or '*'; found %q", s[i])
+			}
+			step.name = s[start:i]
+		}
+		for i < len(s) && s[i] == '[' {
+			end := bytes.IndexByte(s[i:], ']')
+			if end == -1 {
+				return fail("unterminated predicate")
+			}
+			p, err := parsePredicate(s[i+1 : i+end])
+			if err != nil {
+				return fail("%v", err)
+			}
+			step.predicates = append(step.predicates, p)
+			i += end + 1
+		}
+		q.steps = append(q.steps, step)
+	}
+	return q, nil
+}
+
+// MustCompileQuery is like CompileQuery, but panics if the query
+// cannot be parsed.  It simplifies initialising global variables.
+func MustCompileQuery(query string) *Query {
+	q, err := CompileQuery(query)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func isQueryNameChar(c byte) bool {
+	return c != '/' && c != '*' && bytes.IndexByte(tokenChar, c) > -1
+}
+
+func parsePredicate(p []byte) (queryPredicate, error) {
+	switch {
+	case bytes.HasPrefix(p, []byte("head=")):
+		return queryPredicate{kind: headPredicate, value: p[len("head="):]}, nil
+	case bytes.HasPrefix(p, []byte("hint=")):
+		return queryPredicate{kind: hintPredicate, value: p[len("hint="):]}, nil
+	}
+	n, err := strconv.Atoi(string(p))
+	if err != nil || n < 0 {
+		return queryPredicate{}, errors.Errorf("bad predicate %q", p)
+	}
+	return queryPredicate{kind: indexPredicate, index: n}, nil
+}
+
+// String returns the source of q.
+func (q *Query) String() string {
+	return q.source
+}
+
+// Select returns the subexpressions of s selected by q, in the order in
+// which they appear in s, each at most once.
+func (q *Query) Select(s Sexp) []Match {
+	var current []Match
+	for depth, step := range q.steps {
+		var candidates []Match
+		if depth == 0 {
+			// the first step selects from the root itself
+			candidates = []Match{{Sexp: s, Path: []int{}}}
+			if step.descendants {
+				candidates = appendDescendants(candidates, s, []int{})
+			}
+		}
+		for _, m := range current {
+			if step.descendants {
+				candidates = appendDescendants(candidates, m.Sexp, m.Path)
+			} else {
+				candidates = appendChildren(candidates, m.Sexp, m.Path)
+			}
+		}
+		current = nil
+		for _, c := range candidates {
+			if m, ok := step.apply(c); ok {
+				current = append(current, m)
+			}
+		}
+		current = uniqueMatches(current)
+	}
+	return current
+}
+
+// appendChildren appends the children of s, whose path is path, to
+// matches.
+func appendChildren(matches []Match, s Sexp, path []int) []Match {
+	l, ok := s.(List)
+	if !ok {
+		return matches
+	}
+	for i, element := range l {
+		if _, isAtom := element.(Atom); i == 0 && isAtom {
+			continue
+		}
+		matches = append(matches, Match{Sexp: element, Path: appendPath(path, i)})
+	}
+	return matches
+}
+
+// appendDescendants appends all the descendants of s, whose path is
+// path, to matches.
+func appendDescendants(matches []Match, s Sexp, path []int) []Match {
+	start := len(matches)
+	matches = appendChildren(matches, s, path)
+	end := len(matches)
+	for i := start; i < end; i++ {
+		matches = appendDescendants(matches, matches[i].Sexp, matches[i].Path)
+	}
+	return matches
+}
+
+// appendPath returns a copy of path with i appended.
+func appendPath(path []int, i int) []int {
+	return append(append(make([]int, 0, len(path)+1), path...), i)
+}
+
+// head returns the head of s, if it is a list headed by an atom.
+func head(s Sexp) ([]byte, bool) {
+	l, ok := s.(List)
+	if !ok || len(l) == 0 {
+		return nil, false
+	}
+	a, ok := l[0].(Atom)
+	return a.Value, ok
+}
+
+// apply returns m as modified by step, and whether it is selected.
+func (step queryStep) apply(m Match) (Match, bool) {
+	if step.name != nil {
+		if h, ok := head(m.Sexp); !ok || !bytes.Equal(h, step.name) {
+			return m, false
+		}
+	}
+	for _, p := range step.predicates {
+		switch p.kind {
+		case indexPredicate:
+			l, ok := m.Sexp.(List)
+			if !ok || p.index >= len(l) {
+				return m, false
+			}
+			m = Match{Sexp: l[p.index], Path: appendPath(m.Path, p.index)}
+		case headPredicate:
+			if h, ok := head(m.Sexp); !ok || !bytes.Equal(h, p.value) {
+				return m, false
+			}
+		case hintPredicate:
+			if a, ok := m.Sexp.(Atom); !ok || !bytes.Equal(a.DisplayHint, p.value) {
+				return m, false
+			}
+		}
+	}
+	return m, true
+}
+
+// uniqueMatches sorts matches into document order and removes
+// duplicates.
+func uniqueMatches(matches []Match) []Match {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return comparePaths(matches[i].Path, matches[j].Path) < 0
+	})
+	unique := matches[:0]
+	for _, m := range matches {
+		if len(unique) > 0 && comparePaths(m.Path, unique[len(unique)-1].Path) == 0 {
+			continue
+		}
+		unique = append(unique, m)
+	}
+	return unique
+}
+
+// comparePaths orders paths as their S-expressions appear in the
+// root: a list precedes its elements.
+func comparePaths(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,75 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+const queryTestSexp = `(cert
+	(issuer (hash sha256 #01#))
+	(subject (ref alice mother))
+	(tag (ftp [host]ftp.example.com (ref bob)))
+	(comment [text/plain]"hello"))`
+
+func TestQuery(t *testing.T) {
+	s, _, err := Parse([]byte(queryTestSexp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		query    string
+		expected []string // each match, as "path sexp"
+	}{
+		{"/cert/subject/ref[1]", []string{"[2 1 1] alice"}},
+		{"/cert/subject/ref[2]", []string{"[2 1 2] mother"}},
+		{"/cert/subject/ref[3]", nil},
+		{"/cert/subject", []string{"[2] (subject (ref alice mother))"}},
+		{"/subject", nil},
+		{"//ref", []string{"[2 1] (ref alice mother)", "[3 1 2] (ref bob)"}},
+		{"//ref[1]", []string{"[2 1 1] alice", "[3 1 2 1] bob"}},
+		{"/cert/*[0]", []string{"[1 0] issuer", "[2 0] subject", "[3 0] tag", "[4 0] comment"}},
+		{"/cert/*[head=tag]/ftp/*", []string{"[3 1 1] [host]ftp.example.com", "[3 1 2] (ref bob)"}},
+		{"//*[hint=host]", []string{"[3 1 1] [host]ftp.example.com"}},
+		{"//comment/*[hint=text/plain]", []string{"[4 1] [text/plain]hello"}},
+		{"/*", []string{"[] " + s.String()}},
+		{"//*//ref", []string{"[2 1] (ref alice mother)", "[3 1 2] (ref bob)"}},
+		{"/cert//hash/*", []string{"[1 1 1] sha256", "[1 1 2] |AQ==|"}},
+	} {
+		q, err := CompileQuery(test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range q.Select(s) {
+			got = append(got, fmt.Sprint(m.Path, " ", m.Sexp.String()))
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %q; got %q", q, test.expected, got)
+		}
+	}
+}
+
+func TestCompileQueryErrors(t *testing.T) {
+	for _, query := range []string{"", "cert", "/", "//", "/cert/", "/cert[", "/cert[x]", "/cert[-1]", "/cert]", "/a b"} {
+		if _, err := CompileQuery(query); err == nil {
+			t.Errorf("%q: expected error", query)
+		}
+	}
+}
+
+func ExampleQuery() {
+	s, _, err := Parse([]byte("(cert (issuer (hash sha256 #01#)) (subject (ref alice mother)))"))
+	if err != nil {
+		panic(err)
+	}
+	for _, m := range MustCompileQuery("/cert/subject/ref[1]").Select(s) {
+		fmt.Println(m.Path, m.Sexp.String())
+	}
+	// Output:
+	// [2 1 1] alice
+}
@@ -41,9 +41,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/hex"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -164,64 +162,52 @@ const (
 func writeString(buf *bytes.Buffer, a []byte) {
 	// test to see what sort of encoding is best to use
 	encoding := tokenEnc
-	acc := make([]byte, len(a))
 	for i, c := range a {
-		acc[i] = c
 		switch {
+		case i == 0 && bytes.IndexByte(decimalDigit, c) > -1:
+			// a token may not begin with a digit
+			encoding = quotedEnc
 		case bytes.IndexByte(tokenChar, c) > -1:
-			continue
-		case (encoding == tokenEnc) && bytes.IndexByte(stringEncChar, c) > -1:
+		case bytes.IndexByte(stringEncChar, c) > -1:
 			encoding = quotedEnc
-			strAcc := make([]byte, i, len(a))
-			copy(strAcc, acc)
-			for j := i; j < len(a); j++ {
-				c := a[j]
-				if bytes.IndexByte(stringEncChar, c) < 0 {
-					encoding = base64Enc
-					break
-				}
-				switch c {
-				case '\b':
-					acc = append(strAcc, []byte("\\b")...)
-				case '\t':
-					strAcc = append(strAcc, []byte("\\t")...)
-				case '\v':
-					strAcc = append(strAcc, []byte("\\v")...)
-				case '\n':
-					strAcc = append(strAcc, []byte("\\n")...)
-				case '\f':
-					strAcc = append(strAcc, []byte("\\f")...)
-				case '"':
-					strAcc = append(strAcc, []byte("\\\"")...)
-				case '\'':
-					strAcc = append(strAcc, []byte("'")...)
-				case '\\':
-					strAcc = append(strAcc, []byte("\\\\")...)
-				case '\r':
-					strAcc = append(strAcc, []byte("\\r")...)
-				default:
-					strAcc = append(strAcc, c)
-				}
-			}
-			if encoding == quotedEnc {
-				buf.WriteString("\"")
-				buf.Write(strAcc)
-				buf.WriteString("\"")
-				return
-			}
 		default:
 			encoding = base64Enc
 		}
+		if encoding == base64Enc {
+			break
+		}
 	}
 	switch encoding {
 	case base64Enc:
-		buf.WriteString("|" + base64Encoding.EncodeToString(acc) + "|")
+		buf.WriteString("|" + base64Encoding.EncodeToString(a) + "|")
+	case quotedEnc:
+		buf.WriteString("\"")
+		for _, c := range a {
+			switch c {
+			case '\b':
+				buf.WriteString("\\b")
+			case '\t':
+				buf.WriteString("\\t")
+			case '\v':
+				buf.WriteString("\\v")
+			case '\n':
+				buf.WriteString("\\n")
+			case '\f':
+				buf.WriteString("\\f")
+			case '"':
+				buf.WriteString("\\\"")
+			case '\\':
+				buf.WriteString("\\\\")
+			case '\r':
+				buf.WriteString("\\r")
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteString("\"")
 	case tokenEnc:
-		buf.Write(acc)
-	default:
-		panic("Encoding is neither base64 nor token")
+		buf.Write(a)
 	}
-
 }
 
 // StringBuffer implement Sexp.
@@ -330,20 +316,9 @@ func (l List) PackedLen() (size int) {
 }
 
 // Parse returns the first S-expression in byte string s, the unparsed
-// rest of s and any error encountered
+// rest of s and any error encountered.  It enforces DefaultLimits.
 func Parse(s []byte) (sexpr Sexp, rest []byte, err error) {
-	//return parseSexp(bytes)
-	r := bufio.NewReader(bytes.NewReader(s))
-	sexpr, err = Read(r)
-	if err != nil && err != io.EOF {
-		return nil, nil, err
-	}
-	rest, err = ioutil.ReadAll(r)
-	// don't confuse calling code with EOFs
-	if err == io.EOF {
-		err = nil
-	}
-	return sexpr, rest, err
+	return DefaultLimits.Parse(s)
 }
 
 // IsList returns true if its argument is a List.
@@ -355,207 +330,431 @@ func IsList(s Sexp) bool {
 // Read a single S-expression from buffered IO r, returning any error
 // encountered.  May return io.EOF if at end of r; may return a valid
 // S-expression and io.EOF if the EOF was encountered at the end of
-// parsing.
+// parsing.  It enforces DefaultLimits.
 func Read(r *bufio.Reader) (s Sexp, err error) {
-	c, err := r.ReadByte()
+	return DefaultLimits.Read(r)
+}
+
+// reader reads S-expressions from a buffered reader, enforcing limits
+// and keeping track of its position as it goes.
+type reader struct {
+	r      *bufio.Reader
+	limits Limits
+	depth  int   // current list nesting depth
+	n      int64 // bytes consumed
+	start  int64 // offset of the current S-expression, for MaxBytes
+
+	// patterns permits ? in tokens, so that pattern variables need
+	// not be quoted
+	patterns bool
+
+	line      int   // line of the next byte, counting from 0
+	lineStart int64 // offset of the start of the current line
+	lastLine  int   // line of the last byte consumed
+	lastCol   int   // column of the last byte consumed, counting from 0
+
+	recent [contextLen]byte // ring of the most recently consumed bytes
+}
+
+// contextLen is the number of bytes of input on either side of an
+// error reported in a SyntaxError.
+const contextLen = 16
+
+func (p *reader) readByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p.consumed(c)
+	if p.limits.MaxBytes > 0 && p.n-p.start > p.limits.MaxBytes {
+		return 0, &LimitError{Limit: "MaxBytes", Max: p.limits.MaxBytes}
+	}
+	return c, nil
+}
+
+// consumed updates the reader's position for byte c.
+func (p *reader) consumed(c byte) {
+	p.lastLine, p.lastCol = p.line, int(p.n-p.lineStart)
+	p.recent[p.n%contextLen] = c
+	p.n++
+	if c == '\n' {
+		p.line++
+		p.lineStart = p.n
+	}
+}
+
+func (p *reader) unreadByte() error {
+	if err := p.r.UnreadByte(); err != nil {
+		return err
+	}
+	p.n--
+	p.line, p.lineStart = p.lastLine, p.n-int64(p.lastCol)
+	return nil
+}
+
+// readN reads exactly n bytes.  Rather than trusting n and allocating
+// it in advance, it grows its buffer as data arrive; on a short read
+// it returns the bytes read and a SyntaxError.
+func (p *reader) readN(n int64) ([]byte, error) {
+	const chunk = 64 * 1024
+	if p.limits.MaxBytes > 0 && p.n-p.start+n > p.limits.MaxBytes {
+		return nil, &LimitError{Limit: "MaxBytes", Max: p.limits.MaxBytes}
+	}
+	buf := bytes.NewBuffer(nil)
+	if n < chunk {
+		buf.Grow(int(n))
+	} else {
+		buf.Grow(chunk)
+	}
+	m, err := io.CopyN(buf, p.r, n)
+	b := buf.Bytes()
+	for _, c := range b {
+		p.consumed(c)
+	}
+	if err == io.EOF {
+		return b, p.unexpectedEOF(strconv.FormatInt(n, 10) + " bytes")
+	}
+	if err == nil && m < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// readUntil reads up to and including delim, returning the bytes
+// before it with any whitespace removed.  max, if positive, limits the
+// number of bytes returned, and limit names the limit concerned.
+func (p *reader) readUntil(delim byte, max int64, limit string) ([]byte, error) {
+	var acc []byte
+	for {
+		c, err := p.readByte()
+		if err == io.EOF {
+			return nil, p.unexpectedEOF(describe(delim))
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case c == delim:
+			return acc, nil
+		case bytes.IndexByte(whitespaceChar, c) > -1:
+		case max > 0 && int64(len(acc)) >= max:
+			return nil, &LimitError{Limit: limit, Max: max}
+		default:
+			acc = append(acc, c)
+		}
+	}
+}
+
+// syntaxError returns a SyntaxError of the given kind at the last byte
+// consumed.
+func (p *reader) syntaxError(kind error, expected, found string) *SyntaxError {
+	return p.syntaxErrorAt(p.n-1, p.lastLine, p.lastCol, kind, expected, found)
+}
+
+// unexpected returns a SyntaxError reporting that the last byte
+// consumed, c, was not what was expected.
+func (p *reader) unexpected(c byte, expected string) *SyntaxError {
+	return p.syntaxError(ErrUnexpectedCharacter, expected, describe(c))
+}
+
+// unexpectedEOF returns a SyntaxError reporting that input ended where
+// expected was expected.
+func (p *reader) unexpectedEOF(expected string) *SyntaxError {
+	return p.syntaxErrorAt(p.n, p.line, int(p.n-p.lineStart), io.ErrUnexpectedEOF, expected, endOfInput)
+}
+
+func (p *reader) syntaxErrorAt(offset int64, line, col int, kind error, expected, found string) *SyntaxError {
+	if offset < 0 {
+		offset, line, col = 0, 0, 0
+	}
+	// the context consists of recently consumed bytes and those which
+	// follow
+	start := p.n - contextLen
+	if start < 0 {
+		start = 0
+	}
+	context := make([]byte, 0, 2*contextLen)
+	for i := start; i < p.n; i++ {
+		context = append(context, p.recent[i%contextLen])
+	}
+	next, _ := p.r.Peek(contextLen)
+	context = append(context, next...)
+	return &SyntaxError{
+		Kind:     kind,
+		Offset:   offset,
+		Line:     line + 1,
+		Column:   col + 1,
+		Expected: expected,
+		Found:    found,
+		Context:  string(context),
+	}
+}
+
+// maxLen returns the name and value of the limit on the length of
+// display hints or atom values.
+func (p *reader) maxLen(hint bool) (string, int64) {
+	if hint {
+		return "MaxHintLen", p.limits.MaxHintLen
+	}
+	return "MaxAtomLen", p.limits.MaxAtomLen
+}
+
+func (p *reader) read() (s Sexp, err error) {
+	c, err := p.readByte()
 	if err != nil {
 		return nil, err
 	}
 	switch c {
 	case '{':
-		var (
-			enc []byte
-			n   int
-		)
-		if enc, err = r.ReadBytes('}'); err != nil {
-			return nil, errors.Wrap(err, "couldn't read to end of transport-encoded S-expression")
-		}
-		acc := make([]byte, 0, len(enc)-1)
-		for _, c := range enc[:len(enc)-1] {
-			if bytes.IndexByte(whitespaceChar, c) == -1 {
-				acc = append(acc, c)
-			}
+		return p.readTransport()
+	case '(':
+		return p.readList()
+	default:
+		return p.readString(c)
+	}
+}
+
+func (p *reader) readTransport() (s Sexp, err error) {
+	var (
+		enc []byte
+		n   int
+	)
+	if enc, err = p.readUntil('}', 0, ""); err != nil {
+		return nil, err
+	}
+	str := make([]byte, base64Encoding.DecodedLen(len(enc)))
+	if n, err = base64Encoding.Decode(str, enc); err != nil {
+		return nil, p.syntaxError(ErrBadBase64, "transport-encoded S-expression", err.Error())
+	}
+	inner := &reader{r: bufio.NewReader(bytes.NewReader(str[:n])), limits: p.limits, depth: p.depth, patterns: p.patterns}
+	// the encoded bytes have already been counted
+	inner.limits.MaxBytes = 0
+	s, err = inner.read()
+	if s != nil && (err == nil || err == io.EOF) {
+		return s, nil
+	}
+	if err == io.EOF {
+		err = inner.unexpectedEOF("S-expression")
+	}
+	if se, ok := err.(*SyntaxError); ok {
+		// report the error at the end of the transport encoding
+		return nil, p.syntaxError(se.Kind, se.Expected, se.Found+" within transport encoding")
+	}
+	return nil, err
+}
+
+func (p *reader) readList() (s Sexp, err error) {
+	if p.limits.MaxDepth > 0 && p.depth >= p.limits.MaxDepth {
+		return nil, &LimitError{Limit: "MaxDepth", Max: int64(p.limits.MaxDepth)}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+	l := List{}
+	for {
+		var c byte
+		c, err = p.readByte()
+		if err == io.EOF {
+			return nil, p.unexpectedEOF("')'")
 		}
-		str := make([]byte, base64.StdEncoding.DecodedLen(len(acc)))
-		if n, err = base64.StdEncoding.Decode(str, acc); err != nil {
+		if err != nil {
 			return nil, err
 		}
-		s, err = Read(bufio.NewReader(bytes.NewReader(str[:n])))
-		if err == nil || err == io.EOF {
-			return s, nil
+		switch {
+		case c == ')':
+			return l, nil
+		case bytes.IndexByte(whitespaceChar, c) > -1:
+			continue
+		case p.limits.MaxListLen > 0 && len(l) >= p.limits.MaxListLen:
+			return nil, &LimitError{Limit: "MaxListLen", Max: int64(p.limits.MaxListLen)}
 		}
-		return nil, errors.Wrap(err, "couldn't read decoded transport-encoded S-expression")
-	case '(':
-		l := List{}
-		// skip whitespace
-		for {
-			var c byte
-			c, err = r.ReadByte()
-			if err != nil && err != io.EOF {
-				return nil, errors.Wrap(err, "couldn't read next byte of list")
-			}
-			switch {
-			case c == ')':
-				return l, err
-			case bytes.IndexByte(whitespaceChar, c) == -1:
-				if err = r.UnreadByte(); err != nil {
-					return nil, errors.Wrap(err, "couldn't unread byte")
-				}
-				var element Sexp
-				if element, err = Read(r); err != nil {
-					return nil, err
-				}
-				l = append(l, element)
-			}
-			if err != nil {
-				return nil, err
+		if err = p.unreadByte(); err != nil {
+			return nil, errors.Wrap(err, "couldn't unread byte")
+		}
+		var element Sexp
+		if element, err = p.read(); err != nil {
+			if err == io.EOF {
+				// the list is unterminated
+				err = p.unexpectedEOF("')'")
 			}
+			return nil, err
 		}
-	default:
-		return readString(r, c)
+		l = append(l, element)
 	}
 }
 
-func readString(r *bufio.Reader, first byte) (s Sexp, err error) {
+func (p *reader) readString(first byte) (s Sexp, err error) {
 	var displayHint []byte
-	if first == '[' {
-		c, err := r.ReadByte()
+	hinted := first == '['
+	if hinted {
+		c, err := p.readByte()
+		if err == io.EOF {
+			return nil, p.unexpectedEOF("display hint")
+		}
 		if err != nil {
 			return nil, err
 		}
-		displayHint, err = readSimpleString(r, c)
+		displayHint, err = p.readSimpleString(c, true)
+		if err == io.EOF {
+			err = p.unexpectedEOF("']'")
+		}
 		if err != nil {
 			return nil, err
 		}
-		c, err = r.ReadByte()
+		if c, err = p.readByte(); err == io.EOF {
+			return nil, p.unexpectedEOF("']'")
+		}
 		if err != nil {
 			return nil, err
 		}
 		if c != ']' {
-			return nil, fmt.Errorf("']' expected to end display hint; %c found", c)
+			return nil, p.unexpected(c, "']' to end display hint")
+		}
+		if first, err = p.readByte(); err == io.EOF {
+			return nil, p.unexpectedEOF("octet string after display hint")
+		}
+		if err != nil {
+			return nil, err
 		}
-		first, _ = r.ReadByte() // let error be caught by readSimpleString
 	}
-	str, err := readSimpleString(r, first)
+	str, err := p.readSimpleString(first, hinted)
 	return Atom{Value: str, DisplayHint: displayHint}, err
 }
 
-func readSimpleString(r *bufio.Reader, first byte) (b []byte, err error) {
+// readSimpleString reads an octet string beginning with first.  hint
+// is true if the string is a display hint.  Only a token may end at
+// the end of input; io.EOF is returned with it if it does.
+func (p *reader) readSimpleString(first byte, hint bool) (b []byte, err error) {
+	limit, max := p.maxLen(hint)
 	switch {
 	case bytes.IndexByte(decimalDigit, first) > -1:
-		return readLengthDelimited(r, first)
+		return p.readLengthDelimited(first, hint)
 	case first == '#':
-		return readHex(r)
-
+		return p.readHex(-1, hint)
 	case first == '|':
-		return readBase64(r)
+		return p.readBase64(-1, hint)
 	case first == '"':
-		return readQuotedString(r, -1)
-	case bytes.IndexByte(tokenChar, first) > -1:
+		return p.readQuotedString(-1, hint)
+	case p.isTokenChar(first):
 		b = append(b, first)
 		for {
 			var c byte
-			c, err = r.ReadByte()
-			if bytes.IndexByte(tokenChar, c) == -1 {
-				if err = r.UnreadByte(); err != nil {
-					return nil, err
-				}
+			if c, err = p.readByte(); err != nil {
+				// a token may legitimately end at EOF
 				return b, err
 			}
-			b = append(b, c)
-			if err != nil {
-				return nil, err
+			if !p.isTokenChar(c) {
+				return b, p.unreadByte()
 			}
+			if max > 0 && int64(len(b)) >= max {
+				return nil, &LimitError{Limit: limit, Max: max}
+			}
+			b = append(b, c)
 		}
 	}
-	return nil, errors.New("can't readSimpleString")
+	return nil, p.unexpected(first, "S-expression")
 }
 
-func readLengthDelimited(r *bufio.Reader, first byte) (b []byte, err error) {
-	var length int64
-	acc := make([]byte, 1)
-	acc[0] = first
+func (p *reader) isTokenChar(c byte) bool {
+	return bytes.IndexByte(tokenChar, c) > -1 || (p.patterns && c == '?')
+}
+
+func (p *reader) readLengthDelimited(first byte, hint bool) (b []byte, err error) {
+	limit, max := p.maxLen(hint)
+	acc := []byte{first}
 	for {
-		c, err := r.ReadByte()
+		c, err := p.readByte()
+		if err == io.EOF {
+			return nil, p.unexpectedEOF("decimal digit, ':', '#', '|' or '\"'")
+		}
 		if err != nil {
 			return nil, err
 		}
-		switch {
-		case bytes.IndexByte(decimalDigit, c) > -1:
+		if bytes.IndexByte(decimalDigit, c) > -1 {
 			acc = append(acc, c)
-		case c == ':':
-			var n int
-			if length, err = strconv.ParseInt(string(acc), 10, 32); err != nil {
-				return nil, err
-			}
-			acc = make([]byte, 0, length)
-			buf := make([]byte, length)
-			for n, err = r.Read(buf); int64(len(acc)) < length; n, err = r.Read(buf[:length-int64(len(acc))]) {
-				acc = append(acc, buf[:n]...)
-				if err != nil {
-					return acc, err
-				}
-			}
-			return acc, nil
-		case c == '#':
-			if length, err = strconv.ParseInt(string(acc), 10, 32); err != nil {
-				return nil, err
-			}
-			if b, err = readHex(r); err != nil {
-				return nil, errors.Wrap(err, "couldn't read length-delimited bytes")
-			}
-			if len(b) != int(length) {
-				return nil, errors.Errorf("expected %d bytes; got %d", length, len(b))
-			}
-			return b, err
-		case c == '|':
-			length, err := strconv.ParseInt(string(acc), 10, 32)
-			if err != nil {
-				return nil, err
-			}
-			if b, err = readBase64(r); err != nil {
-				return nil, errors.Wrap(err, "couldn't read Base64-encoded bytes")
-			}
-			if len(b) != int(length) {
-				return nil, errors.Errorf("expected %d bytes; got %d", length, len(b))
-			}
-			return b, err
-		default:
-			return nil, errors.Errorf("expected integer; found %c", c)
+			continue
+		}
+		if c != ':' && c != '#' && c != '|' && c != '"' {
+			return nil, p.unexpected(c, "decimal digit, ':', '#', '|' or '\"'")
+		}
+		length, err := strconv.ParseInt(string(acc), 10, 32)
+		if err != nil {
+			return nil, p.syntaxError(ErrBadLength, "length of at most 2147483647", string(acc))
+		}
+		if max > 0 && length > max {
+			return nil, &LimitError{Limit: limit, Max: max}
+		}
+		switch c {
+		case ':':
+			return p.readN(length)
+		case '#':
+			b, err = p.readHex(length, hint)
+		case '|':
+			b, err = p.readBase64(length, hint)
+		case '"':
+			return p.readQuotedString(int(length), hint)
 		}
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != int(length) {
+			return nil, p.syntaxError(ErrLengthMismatch, string(acc)+" bytes", strconv.Itoa(len(b)))
+		}
+		return b, nil
 	}
 }
 
-func readHex(r *bufio.Reader) (b []byte, err error) {
-	var n int
-	if b, err = r.ReadBytes('#'); err != nil {
-		return nil, errors.Wrap(err, "couldn't read to #")
+// readHex reads hexadecimal-encoded bytes up to a closing '#'.  length,
+// if non-negative, is the expected number of bytes.
+func (p *reader) readHex(length int64, hint bool) (b []byte, err error) {
+	limit, max := p.maxLen(hint)
+	if length >= 0 {
+		max = length
 	}
-	acc := make([]byte, 0, len(b)-1)
-	for _, c := range b[:len(b)-1] {
-		if bytes.IndexByte(whitespaceChar, c) == -1 {
-			acc = append(acc, c)
-		}
+	var acc []byte
+	if acc, err = p.readUntil('#', 2*max, limit); err != nil {
+		return nil, p.lengthExceeded(length, err)
 	}
 	b = make([]byte, hex.DecodedLen(len(acc)))
-	n, err = hex.Decode(b, acc)
-	return b[:n], err
+	n, err := hex.Decode(b, acc)
+	if err != nil {
+		return nil, p.syntaxError(ErrBadHex, "hexadecimal digits", err.Error())
+	}
+	if max > 0 && int64(n) > max {
+		return nil, p.lengthExceeded(length, &LimitError{Limit: limit, Max: max})
+	}
+	return b[:n], nil
 }
 
-func readBase64(r *bufio.Reader) (b []byte, err error) {
-	var n int
-	if b, err = r.ReadBytes('|'); err != nil {
-		return nil, errors.Wrap(err, "couldn't read to |")
+// readBase64 reads base64-encoded bytes up to a closing '|'.  length,
+// if non-negative, is the expected number of bytes.
+func (p *reader) readBase64(length int64, hint bool) (b []byte, err error) {
+	limit, max := p.maxLen(hint)
+	if length >= 0 {
+		max = length
 	}
-	acc := make([]byte, 0, len(b)-1)
-	for _, c := range b[:len(b)-1] {
-		if bytes.IndexByte(whitespaceChar, c) == -1 {
-			acc = append(acc, c)
-		}
+	var acc []byte
+	if acc, err = p.readUntil('|', int64(base64Encoding.EncodedLen(int(max))), limit); err != nil {
+		return nil, p.lengthExceeded(length, err)
+	}
+	b = make([]byte, base64Encoding.DecodedLen(len(acc)))
+	n, err := base64Encoding.Decode(b, acc)
+	if err != nil {
+		return nil, p.syntaxError(ErrBadBase64, "base64 characters", err.Error())
+	}
+	if max > 0 && int64(n) > max {
+		return nil, p.lengthExceeded(length, &LimitError{Limit: limit, Max: max})
+	}
+	return b[:n], nil
+}
+
+// lengthExceeded returns err, unless it is a LimitError reporting that
+// an octet string with the given length prefix was too long, in which
+// case it returns a SyntaxError.
+func (p *reader) lengthExceeded(length int64, err error) error {
+	if _, ok := err.(*LimitError); ok && length >= 0 {
+		return p.syntaxError(ErrLengthMismatch, strconv.FormatInt(length, 10)+" bytes", "more")
 	}
-	b = make([]byte, base64.StdEncoding.DecodedLen(len(acc)))
-	n, err = base64.StdEncoding.Decode(b, acc)
-	return b[:n], err
+	return err
 }
 
 type quoteState int
@@ -571,24 +770,51 @@ const (
 	inOctal3
 )
 
-func readQuotedString(r *bufio.Reader, length int) (s []byte, err error) {
+// readQuotedString reads a quoted string up to its closing '"'.
+// length, if non-negative, is the expected number of bytes.
+func (p *reader) readQuotedString(length int, hint bool) (s []byte, err error) {
 	var acc, escape []byte
-	if length >= 0 {
+	limit, max := p.maxLen(hint)
+	// length is read from the input, so it is not trusted to allocate
+	// more than readN would
+	const chunk = 64 * 1024
+	switch {
+	case length > chunk:
+		acc = make([]byte, 0, chunk)
+	case length >= 0:
 		acc = make([]byte, 0, length)
-	} else {
+	default:
 		acc = make([]byte, 0)
 	}
 	escape = make([]byte, 3)
 	state := inQuote
-	for c, err := r.ReadByte(); err == nil; c, err = r.ReadByte() {
+	for {
+		c, err := p.readByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if max > 0 && int64(len(acc)) > max {
+			return nil, &LimitError{Limit: limit, Max: max}
+		}
 		switch state {
+		case inNewlineEscape, inReturnEscape:
+			if (state == inNewlineEscape && c == '\r') || (state == inReturnEscape && c == '\n') {
+				// \<CR><LF> and \<LF><CR> are ignored as a whole
+				state = inQuote
+				continue
+			}
+			state = inQuote
+			fallthrough
 		case inQuote:
 			switch c {
 			case '"':
-				if length > 0 && len(acc) != length {
-					return nil, fmt.Errorf("Length mismatch")
+				if length >= 0 && len(acc) != length {
+					return nil, p.syntaxError(ErrLengthMismatch, strconv.Itoa(length)+" bytes", strconv.Itoa(len(acc)))
 				}
-				return acc, err
+				return acc, nil
 			case '\\':
 				state = inEscape
 			default:
@@ -630,79 +856,44 @@ func readQuotedString(r *bufio.Reader, length int) (s []byte, err error) {
 			case byte('x'):
 				state = inHex1
 			default:
-				if bytes.IndexByte(octalDigit, c) > -1 {
-					state = inOctal2
-					escape[0] = c
-				} else {
-					return nil, fmt.Errorf("Unrecognised escape character %c", rune(c))
-				}
-				state = inQuote
-			}
-		case inNewlineEscape:
-			switch c {
-			case '\r':
-				// pass
-			case '"':
-				if length > 0 && len(acc) != length {
-					return nil, fmt.Errorf("Length mismatch")
-				}
-				return acc, nil
-			default:
-				acc = append(acc, c)
-			}
-			state = inQuote
-		case inReturnEscape:
-			switch c {
-			case '\n':
-				// pass
-			case '"':
-				if length > 0 && len(acc) != length {
-					return nil, fmt.Errorf("Length mismatch")
+				if bytes.IndexByte(octalDigit, c) == -1 {
+					return nil, p.syntaxError(ErrBadEscape, "escape character", describe(c))
 				}
-				return acc, nil
-			default:
-				acc = append(acc, c)
+				state = inOctal2
+				escape[0] = c
 			}
-			state = inQuote
 		case inHex1:
-			if bytes.IndexByte(hexadecimalDigit, c) > -1 {
-				state = inHex2
-				escape[0] = c
-			} else {
-				return nil, fmt.Errorf("Expected hexadecimal digit; got %c", c)
+			if bytes.IndexByte(hexadecimalDigit, c) == -1 {
+				return nil, p.syntaxError(ErrBadEscape, "hexadecimal digit", describe(c))
 			}
+			state = inHex2
+			escape[0] = c
 		case inHex2:
-			if bytes.IndexByte(hexadecimalDigit, c) > -1 {
-				state = inQuote
-				escape[2] = c
-				num, err := strconv.ParseInt(string(escape[:2]), 16, 8)
-				if err != nil {
-					return nil, err
-				}
-				acc = append(acc, byte(num))
-			} else {
-				return nil, fmt.Errorf("Expected hexadecimal digit; got %c", c)
+			if bytes.IndexByte(hexadecimalDigit, c) == -1 {
+				return nil, p.syntaxError(ErrBadEscape, "hexadecimal digit", describe(c))
 			}
+			state = inQuote
+			escape[1] = c
+			num, _ := strconv.ParseUint(string(escape[:2]), 16, 8)
+			acc = append(acc, byte(num))
 		case inOctal2:
-			if bytes.IndexByte(octalDigit, c) > -1 {
-				state = inOctal3
-				escape[1] = c
-			} else {
-				return nil, fmt.Errorf("Expected octal digit; got %c", c)
+			if bytes.IndexByte(octalDigit, c) == -1 {
+				return nil, p.syntaxError(ErrBadEscape, "octal digit", describe(c))
 			}
+			state = inOctal3
+			escape[1] = c
 		case inOctal3:
-			if bytes.IndexByte(octalDigit, c) > -1 {
-				state = inQuote
-				escape[2] = c
-				num, err := strconv.ParseInt(string(escape[:2]), 8, 8)
-				if err != nil {
-					return nil, err
-				}
-				acc = append(acc, byte(num))
-			} else {
-				return nil, fmt.Errorf("Expected octal digit; got %c", c)
+			if bytes.IndexByte(octalDigit, c) == -1 {
+				return nil, p.syntaxError(ErrBadEscape, "octal digit", describe(c))
+			}
+			state = inQuote
+			escape[2] = c
+			num, err := strconv.ParseUint(string(escape[:3]), 8, 8)
+			if err != nil {
+				return nil, p.syntaxError(ErrBadEscape, "octal escape of at most \\377", "\\"+string(escape))
 			}
+			acc = append(acc, byte(num))
 		}
 	}
-	return nil, fmt.Errorf("Unterminated string")
+	return nil, p.syntaxErrorAt(p.n, p.line, int(p.n-p.lineStart), ErrUnterminatedString, "'\"'", endOfInput)
 }
@@ -313,3 +313,36 @@ func ExampleList_String() {
 	// (foo ([text/plain]"bar baz" [|AQID|]""))
 	// true
 }
+
+func TestQuotedStringEscapes(t *testing.T) {
+	s, _, err := Parse([]byte(`"\x41\102\t\\\"\'"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Equal(Atom{Value: []byte("AB\t\\\"'")}) {
+		t.Fatalf("Bad %s", s)
+	}
+	s, _, err = Parse([]byte("7\"subject\""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Equal(Atom{Value: []byte("subject")}) {
+		t.Fatalf("Bad %s", s)
+	}
+	if _, _, err = Parse([]byte("8\"subject\"")); err == nil {
+		t.Fatal("Length mismatch not detected")
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, value := range []string{"123", "1abc", "a\bc", "-3", "", "x y", "\x00\xff"} {
+		a := Atom{Value: []byte(value)}
+		s, _, err := Parse([]byte(a.String()))
+		if err != nil {
+			t.Fatalf("%q: %v", a.String(), err)
+		}
+		if !s.Equal(a) {
+			t.Fatalf("%q read back as %s", a.String(), s)
+		}
+	}
+}
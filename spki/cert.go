@@ -0,0 +1,347 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"time"
+
+	"github.com/eadmund/sexprs"
+)
+
+// A Cert is a certificate, by which its issuer grants the authority
+// described by its tag to its subject, e.g.:
+//    (cert
+//      (issuer (hash sha256 |...|))
+//      (subject (public-key (ed25519 (q |...|))))
+//      (tag (ftp ftp.example.com))
+//      (valid (not-after "2014-01-01_00:00:00")))
+// If Propagate is true, the subject may delegate that authority in
+// turn.
+type Cert struct {
+	Version   []byte // if present, (version <Version>)
+	Display   []byte // if present, (display <Display>)
+	Issuer    Principal
+	Subject   Subject
+	Propagate bool
+	Tag       sexprs.Sexp // the body of (tag ...); (*) grants everything
+	Valid     *Validity
+	Comment   string // if present, (comment <Comment>)
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (c Cert) MarshalSexp() (sexprs.Sexp, error) {
+	l := list("cert")
+	if c.Version != nil {
+		l = append(l, list("version", atom(c.Version)))
+	}
+	if c.Display != nil {
+		l = append(l, list("display", atom(c.Display)))
+	}
+	issuer, err := c.Issuer.MarshalSexp()
+	if err != nil {
+		return nil, err
+	}
+	subject, err := c.Subject.MarshalSexp()
+	if err != nil {
+		return nil, err
+	}
+	l = append(l, list("issuer", issuer), subject)
+	if c.Propagate {
+		l = append(l, list("propagate"))
+	}
+	if c.Tag == nil {
+		return nil, malformed("cert without tag")
+	}
+	l = append(l, list("tag", c.Tag))
+	if c.Valid != nil {
+		valid, err := c.Valid.MarshalSexp()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, valid)
+	}
+	if c.Comment != "" {
+		l = append(l, list("comment", atom([]byte(c.Comment))))
+	}
+	return l, nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.  The fields of the cert
+// must appear in the order of Cert's fields, each at most once.
+func (c *Cert) UnmarshalSexp(s sexprs.Sexp) error {
+	rest, err := expect(s, "cert")
+	if err != nil {
+		return err
+	}
+	var (
+		parsed          Cert
+		issuer, subject bool
+		position        int
+	)
+	order := []string{"version", "display", "issuer", "subject", "propagate", "tag", "valid", "comment"}
+	for _, field := range rest {
+		fieldName, fieldBody := head(field)
+		// each field may appear at most once, in order
+		for position < len(order) && order[position] != fieldName {
+			position++
+		}
+		if position == len(order) {
+			return malformed("unexpected cert field %s", field)
+		}
+		position++
+		switch fieldName {
+		case "version", "display", "comment":
+			if len(fieldBody) != 1 {
+				return malformed("expected (%s value); got %s", fieldName, field)
+			}
+			b, err := octets(fieldBody[0], fieldName)
+			if err != nil {
+				return err
+			}
+			switch fieldName {
+			case "version":
+				parsed.Version = append([]byte{}, b...)
+			case "display":
+				parsed.Display = append([]byte{}, b...)
+			case "comment":
+				// which MarshalSexp would omit
+				if len(b) == 0 {
+					return malformed("empty comment")
+				}
+				parsed.Comment = string(b)
+			}
+		case "issuer":
+			if len(fieldBody) != 1 {
+				return malformed("expected (issuer principal); got %s", field)
+			}
+			if err = parsed.Issuer.UnmarshalSexp(fieldBody[0]); err != nil {
+				return err
+			}
+			issuer = true
+		case "subject":
+			if err = parsed.Subject.UnmarshalSexp(field); err != nil {
+				return err
+			}
+			subject = true
+		case "propagate":
+			if len(fieldBody) != 0 {
+				return malformed("expected (propagate); got %s", field)
+			}
+			parsed.Propagate = true
+		case "tag":
+			if len(fieldBody) != 1 {
+				return malformed("expected (tag body); got %s", field)
+			}
+			parsed.Tag = fieldBody[0]
+		case "valid":
+			parsed.Valid = &Validity{}
+			if err = parsed.Valid.UnmarshalSexp(field); err != nil {
+				return err
+			}
+		}
+	}
+	switch {
+	case !issuer:
+		return malformed("cert without issuer")
+	case !subject:
+		return malformed("cert without subject")
+	case parsed.Tag == nil:
+		return malformed("cert without tag")
+	}
+	*c = parsed
+	return nil
+}
+
+// A Subject is the subject of a cert: a principal, or a name relative
+// to one, e.g. (subject (name (hash sha256 |...|) alice)).  Exactly
+// one of Principal and Name must be set.
+type Subject struct {
+	Principal *Principal
+	Name      *Name
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (s Subject) MarshalSexp() (sexprs.Sexp, error) {
+	var (
+		body sexprs.Sexp
+		err  error
+	)
+	switch {
+	case s.Principal != nil && s.Name == nil:
+		body, err = s.Principal.MarshalSexp()
+	case s.Name != nil && s.Principal == nil:
+		body, err = s.Name.MarshalSexp()
+	default:
+		return nil, malformed("subject must have exactly one of principal and name")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return list("subject", body), nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (s *Subject) UnmarshalSexp(sexp sexprs.Sexp) error {
+	rest, err := expect(sexp, "subject")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return malformed("expected (subject principal-or-name); got %s", sexp)
+	}
+	if name, _ := head(rest[0]); name == "name" {
+		n := &Name{}
+		if err = n.UnmarshalSexp(rest[0]); err != nil {
+			return err
+		}
+		*s = Subject{Name: n}
+		return nil
+	}
+	p := &Principal{}
+	if err = p.UnmarshalSexp(rest[0]); err != nil {
+		return err
+	}
+	*s = Subject{Principal: p}
+	return nil
+}
+
+// A Name is an SDSI name: a sequence of names in the name space of a
+// principal, e.g. (name (hash sha256 |...|) alice mother).  If
+// Principal is nil the name is relative to the issuer of the
+// certificate in which it appears.
+type Name struct {
+	Principal *Principal
+	Names     []string
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (n Name) MarshalSexp() (sexprs.Sexp, error) {
+	if len(n.Names) == 0 {
+		return nil, malformed("empty name")
+	}
+	l := list("name")
+	if n.Principal != nil {
+		p, err := n.Principal.MarshalSexp()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, p)
+	}
+	for _, name := range n.Names {
+		if name == "" {
+			return nil, malformed("empty name")
+		}
+		l = append(l, atom([]byte(name)))
+	}
+	return l, nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (n *Name) UnmarshalSexp(s sexprs.Sexp) error {
+	rest, err := expect(s, "name")
+	if err != nil {
+		return err
+	}
+	var parsed Name
+	if len(rest) > 0 && sexprs.IsList(rest[0]) {
+		parsed.Principal = &Principal{}
+		if err = parsed.Principal.UnmarshalSexp(rest[0]); err != nil {
+			return err
+		}
+		rest = rest[1:]
+	}
+	if len(rest) == 0 {
+		return malformed("empty name %s", s)
+	}
+	for _, element := range rest {
+		name, err := token(element, "name")
+		if err != nil {
+			return err
+		}
+		parsed.Names = append(parsed.Names, name)
+	}
+	*n = parsed
+	return nil
+}
+
+// DateFormat is the layout, for time.Format and time.Parse, of SPKI
+// dates, which are always in UTC.
+const DateFormat = "2006-01-02_15:04:05"
+
+// A Validity limits the period for which a cert is valid, e.g.:
+//    (valid (not-before "2013-01-01_00:00:00") (not-after "2014-01-01_00:00:00"))
+// A zero time imposes no limit, and is omitted.
+type Validity struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+}
+
+// Contains reports whether t is within the period of v.
+func (v Validity) Contains(t time.Time) bool {
+	return (v.NotBefore.IsZero() || !t.Before(v.NotBefore)) && (v.NotAfter.IsZero() || !t.After(v.NotAfter))
+}
+
+// Intersect returns the period within both v and w.  ok is false if
+// there is none.
+func (v Validity) Intersect(w Validity) (period Validity, ok bool) {
+	period = v
+	if !w.NotBefore.IsZero() && (period.NotBefore.IsZero() || w.NotBefore.After(period.NotBefore)) {
+		period.NotBefore = w.NotBefore
+	}
+	if !w.NotAfter.IsZero() && (period.NotAfter.IsZero() || w.NotAfter.Before(period.NotAfter)) {
+		period.NotAfter = w.NotAfter
+	}
+	if !period.NotBefore.IsZero() && !period.NotAfter.IsZero() && period.NotAfter.Before(period.NotBefore) {
+		return Validity{}, false
+	}
+	return period, true
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (v Validity) MarshalSexp() (sexprs.Sexp, error) {
+	l := list("valid")
+	if !v.NotBefore.IsZero() {
+		l = append(l, list("not-before", atom([]byte(v.NotBefore.UTC().Format(DateFormat)))))
+	}
+	if !v.NotAfter.IsZero() {
+		l = append(l, list("not-after", atom([]byte(v.NotAfter.UTC().Format(DateFormat)))))
+	}
+	return l, nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (v *Validity) UnmarshalSexp(s sexprs.Sexp) error {
+	rest, err := expect(s, "valid")
+	if err != nil {
+		return err
+	}
+	var parsed Validity
+	for i, element := range rest {
+		name, body := head(element)
+		var t *time.Time
+		switch {
+		case name == "not-before" && i == 0:
+			t = &parsed.NotBefore
+		case name == "not-after" && (i == 0 || i == 1 && !parsed.NotBefore.IsZero()):
+			t = &parsed.NotAfter
+		default:
+			return malformed("unexpected validity field %s", element)
+		}
+		if len(body) != 1 {
+			return malformed("expected (%s date); got %s", name, element)
+		}
+		date, err := token(body[0], "date")
+		if err != nil {
+			return err
+		}
+		// time.Parse accepts fractional seconds, which MarshalSexp
+		// would omit, as it would the zero time
+		if *t, err = time.Parse(DateFormat, date); err != nil || t.IsZero() || t.Format(DateFormat) != date {
+			return malformed("bad date %q", date)
+		}
+	}
+	*v = parsed
+	return nil
+}
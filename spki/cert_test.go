@@ -0,0 +1,70 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/eadmund/sexprs"
+)
+
+func TestValidity(t *testing.T) {
+	v := Validity{
+		NotBefore: time.Date(2013, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:  time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, test := range []struct {
+		t        time.Time
+		expected bool
+	}{
+		{time.Date(2012, 12, 31, 23, 59, 59, 0, time.UTC), false},
+		{v.NotBefore, true},
+		{time.Date(2013, 6, 1, 0, 0, 0, 0, time.UTC), true},
+		{v.NotAfter, true},
+		{time.Date(2014, 1, 1, 0, 0, 1, 0, time.UTC), false},
+	} {
+		if v.Contains(test.t) != test.expected {
+			t.Errorf("%v: expected %v", test.t, test.expected)
+		}
+	}
+	if !(Validity{}).Contains(time.Now()) {
+		t.Error("empty validity excludes now")
+	}
+	// dates are always marshalled in UTC
+	est := time.FixedZone("EST", -5*60*60)
+	s, err := Validity{NotAfter: time.Date(2013, 12, 31, 19, 0, 0, 0, est)}.MarshalSexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `(valid (not-after "2014-01-01_00:00:00"))`; s.String() != expected {
+		t.Errorf("expected %s; got %s", expected, s)
+	}
+}
+
+func ExampleCert() {
+	alice := &PublicKey{Algorithm: "ed25519", Params: []Param{{Name: "q", Value: []byte{1, 2, 3}}}}
+	bob := &Hash{Algorithm: "sha256", Digest: []byte{4, 5, 6}}
+	cert := Cert{
+		Issuer:    Principal{Key: alice},
+		Subject:   Subject{Name: &Name{Principal: &Principal{Hash: bob}, Names: []string{"friends"}}},
+		Propagate: true,
+		Tag:       sexprs.List{sexprs.Atom{Value: []byte("read")}},
+		Valid:     &Validity{NotAfter: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	s, err := sexprs.Marshal(cert)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Print(sexprs.DefaultPrinter.Sprint(s))
+	// Output:
+	// (cert
+	//   (issuer (public-key (ed25519 (q |AQID|))))
+	//   (subject (name (hash sha256 |BAUG|) friends))
+	//   (propagate)
+	//   (tag (read))
+	//   (valid (not-after "2014-01-01_00:00:00")))
+}
@@ -0,0 +1,239 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"bytes"
+
+	"github.com/eadmund/sexprs"
+)
+
+// A Hash is the hash of some object, e.g.:
+//    (hash sha256 |n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=|)
+// optionally followed by a (uri ...) list of places where the object
+// may be found.
+type Hash struct {
+	Algorithm string
+	Digest    []byte
+	URIs      []string
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (h Hash) MarshalSexp() (sexprs.Sexp, error) {
+	if h.Algorithm == "" {
+		return nil, malformed("hash without algorithm")
+	}
+	l := list("hash", atom([]byte(h.Algorithm)), atom(h.Digest))
+	return appendURIs(l, h.URIs), nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (h *Hash) UnmarshalSexp(s sexprs.Sexp) (err error) {
+	rest, err := expect(s, "hash")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 2 || len(rest) > 3 {
+		return malformed("expected (hash algorithm digest [uris]); got %s", s)
+	}
+	var parsed Hash
+	if parsed.Algorithm, err = token(rest[0], "hash algorithm"); err != nil {
+		return err
+	}
+	digest, err := octets(rest[1], "hash value")
+	if err != nil {
+		return err
+	}
+	parsed.Digest = append([]byte{}, digest...)
+	if len(rest) == 3 {
+		if parsed.URIs, err = parseURIs(rest[2]); err != nil {
+			return err
+		}
+	}
+	*h = parsed
+	return nil
+}
+
+// A PublicKey is a public key, consisting of the name of its
+// algorithm and its parameters, e.g.:
+//    (public-key (rsa-pkcs1-sha256 (e #010001#) (n |...|)))
+// optionally followed by a (uri ...) list.
+type PublicKey struct {
+	Algorithm string
+	Params    []Param
+	URIs      []string
+}
+
+// A Param is a named parameter of a public key, e.g. (e #010001#).
+type Param struct {
+	Name  string
+	Value []byte
+}
+
+// Param returns the value of the parameter named name, or nil if there
+// is none.
+func (k PublicKey) Param(name string) []byte {
+	for _, p := range k.Params {
+		if p.Name == name {
+			return p.Value
+		}
+	}
+	return nil
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (k PublicKey) MarshalSexp() (sexprs.Sexp, error) {
+	if k.Algorithm == "" {
+		return nil, malformed("public key without algorithm")
+	}
+	alg := list(k.Algorithm)
+	for _, p := range k.Params {
+		if p.Name == "" {
+			return nil, malformed("unnamed public key parameter")
+		}
+		alg = append(alg, list(p.Name, atom(p.Value)))
+	}
+	return appendURIs(list("public-key", alg), k.URIs), nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (k *PublicKey) UnmarshalSexp(s sexprs.Sexp) (err error) {
+	rest, err := expect(s, "public-key")
+	if err != nil {
+		return err
+	}
+	if len(rest) < 1 || len(rest) > 2 {
+		return malformed("expected (public-key (algorithm ...) [uris]); got %s", s)
+	}
+	var parsed PublicKey
+	name, params := head(rest[0])
+	if name == "" {
+		return malformed("expected (algorithm ...); got %s", rest[0])
+	}
+	parsed.Algorithm = name
+	for _, p := range params {
+		pname, value := head(p)
+		if pname == "" || len(value) != 1 {
+			return malformed("expected (name value) public key parameter; got %s", p)
+		}
+		b, err := octets(value[0], "parameter value")
+		if err != nil {
+			return err
+		}
+		parsed.Params = append(parsed.Params, Param{Name: pname, Value: append([]byte{}, b...)})
+	}
+	if len(rest) == 2 {
+		if parsed.URIs, err = parseURIs(rest[1]); err != nil {
+			return err
+		}
+	}
+	*k = parsed
+	return nil
+}
+
+// A Principal is an entity which may sign statements: either a public
+// key or the hash of one.  Exactly one of Key and Hash must be set.
+type Principal struct {
+	Key  *PublicKey
+	Hash *Hash
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (p Principal) MarshalSexp() (sexprs.Sexp, error) {
+	switch {
+	case p.Key != nil && p.Hash == nil:
+		return p.Key.MarshalSexp()
+	case p.Hash != nil && p.Key == nil:
+		return p.Hash.MarshalSexp()
+	}
+	return nil, malformed("principal must have exactly one of key and hash")
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (p *Principal) UnmarshalSexp(s sexprs.Sexp) error {
+	switch name, _ := head(s); name {
+	case "public-key":
+		k := &PublicKey{}
+		if err := k.UnmarshalSexp(s); err != nil {
+			return err
+		}
+		*p = Principal{Key: k}
+	case "hash":
+		h := &Hash{}
+		if err := h.UnmarshalSexp(s); err != nil {
+			return err
+		}
+		*p = Principal{Hash: h}
+	default:
+		return malformed("expected principal; got %s", s)
+	}
+	return nil
+}
+
+// Matches reports whether p and q are the same principal: the same
+// public key, the same hash, or a public key and its hash.  URIs are
+// ignored.
+func (p Principal) Matches(q Principal) bool {
+	switch {
+	case p.Key != nil && q.Key != nil:
+		a, err := bareKey(p.Key)
+		if err != nil {
+			return false
+		}
+		b, err := bareKey(q.Key)
+		return err == nil && a.Equal(b)
+	case p.Hash != nil && q.Hash != nil:
+		return p.Hash.Algorithm == q.Hash.Algorithm && bytes.Equal(p.Hash.Digest, q.Hash.Digest)
+	case p.Key != nil && q.Hash != nil:
+		return keyHashes(p.Key, q.Hash)
+	case p.Hash != nil && q.Key != nil:
+		return keyHashes(q.Key, p.Hash)
+	}
+	return false
+}
+
+// bareKey returns the S-expression of k without its URIs.
+func bareKey(k *PublicKey) (sexprs.Sexp, error) {
+	return PublicKey{Algorithm: k.Algorithm, Params: k.Params}.MarshalSexp()
+}
+
+// keyHashes reports whether h is the hash of k.
+func keyHashes(k *PublicKey, h *Hash) bool {
+	s, err := bareKey(k)
+	if err != nil {
+		return false
+	}
+	kh, err := NewHash(s, h.Algorithm)
+	return err == nil && bytes.Equal(kh.Digest, h.Digest)
+}
+
+func appendURIs(l sexprs.List, uris []string) sexprs.List {
+	if len(uris) == 0 {
+		return l
+	}
+	u := list("uri")
+	for _, uri := range uris {
+		u = append(u, atom([]byte(uri)))
+	}
+	return append(l, u)
+}
+
+func parseURIs(s sexprs.Sexp) (uris []string, err error) {
+	rest, err := expect(s, "uri")
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 {
+		return nil, malformed("empty uri list")
+	}
+	for _, u := range rest {
+		uri, err := token(u, "uri")
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, uri)
+	}
+	return uris, nil
+}
@@ -0,0 +1,213 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256" // register the hashes named in hashes
+	_ "crypto/sha512"
+	"math/big"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+// ErrBadSignature is reported by errors.Is when a signature does not
+// verify.
+var ErrBadSignature = errors.New("bad signature")
+
+// hashes are the hash algorithms which may be named in a Hash.
+var hashes = map[string]crypto.Hash{
+	"sha256": crypto.SHA256,
+	"sha384": crypto.SHA384,
+	"sha512": crypto.SHA512,
+}
+
+// signatureHashes are the hash algorithms with which each public key
+// algorithm signs.
+var signatureHashes = map[string]string{
+	"ed25519":          "sha256",
+	"ecdsa-sha256":     "sha256",
+	"rsa-pkcs1-sha256": "sha256",
+}
+
+// curves are the names of the curves of ECDSA keys.
+var curves = map[string]elliptic.Curve{
+	"p256": elliptic.P256(),
+	"p384": elliptic.P384(),
+	"p521": elliptic.P521(),
+}
+
+// NewHash returns the hash of the canonical representation of s, using
+// the named algorithm: sha256, sha384 or sha512.
+func NewHash(s sexprs.Sexp, algorithm string) (*Hash, error) {
+	return hashBytes(s.Pack(), algorithm)
+}
+
+func hashBytes(b []byte, algorithm string) (*Hash, error) {
+	h, ok := hashes[algorithm]
+	if !ok {
+		return nil, errors.Errorf("unsupported hash algorithm %q", algorithm)
+	}
+	digest := h.New()
+	digest.Write(b)
+	return &Hash{Algorithm: algorithm, Digest: digest.Sum(nil)}, nil
+}
+
+// NewPublicKey returns the SPKI form of pub, which must be an
+// ed25519.PublicKey, *ecdsa.PublicKey or *rsa.PublicKey.  They are
+// represented respectively as:
+//    (public-key (ed25519 (q |...|)))
+//    (public-key (ecdsa-sha256 (curve p256) (x |...|) (y |...|)))
+//    (public-key (rsa-pkcs1-sha256 (e #010001#) (n |...|)))
+func NewPublicKey(pub crypto.PublicKey) (*PublicKey, error) {
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return &PublicKey{Algorithm: "ed25519", Params: []Param{{Name: "q", Value: append([]byte{}, pub...)}}}, nil
+	case *ecdsa.PublicKey:
+		for name, curve := range curves {
+			if curve != pub.Curve {
+				continue
+			}
+			size := (curve.Params().BitSize + 7) / 8
+			return &PublicKey{Algorithm: "ecdsa-sha256", Params: []Param{
+				{Name: "curve", Value: []byte(name)},
+				{Name: "x", Value: pub.X.FillBytes(make([]byte, size))},
+				{Name: "y", Value: pub.Y.FillBytes(make([]byte, size))},
+			}}, nil
+		}
+		return nil, errors.Errorf("unsupported ECDSA curve %s", pub.Curve.Params().Name)
+	case *rsa.PublicKey:
+		return &PublicKey{Algorithm: "rsa-pkcs1-sha256", Params: []Param{
+			{Name: "e", Value: big.NewInt(int64(pub.E)).Bytes()},
+			{Name: "n", Value: pub.N.Bytes()},
+		}}, nil
+	}
+	return nil, errors.Errorf("unsupported public key type %T", pub)
+}
+
+// CryptoPublicKey returns k as an ed25519.PublicKey, *ecdsa.PublicKey
+// or *rsa.PublicKey, reversing NewPublicKey.
+func (k PublicKey) CryptoPublicKey() (crypto.PublicKey, error) {
+	switch k.Algorithm {
+	case "ed25519":
+		q := k.Param("q")
+		if len(q) != ed25519.PublicKeySize {
+			return nil, malformed("bad ed25519 key")
+		}
+		return ed25519.PublicKey(append([]byte{}, q...)), nil
+	case "ecdsa-sha256":
+		curve, ok := curves[string(k.Param("curve"))]
+		if !ok {
+			return nil, malformed("unsupported ECDSA curve %q", k.Param("curve"))
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(k.Param("x")),
+			Y:     new(big.Int).SetBytes(k.Param("y")),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, malformed("ECDSA key not on curve")
+		}
+		return pub, nil
+	case "rsa-pkcs1-sha256":
+		e := new(big.Int).SetBytes(k.Param("e"))
+		n := new(big.Int).SetBytes(k.Param("n"))
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || n.Sign() == 0 {
+			return nil, malformed("bad RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	}
+	return nil, errors.Errorf("unsupported public key algorithm %q", k.Algorithm)
+}
+
+// Sign returns the signature by signer of the SHA-256 hash of the
+// canonical representation of s, e.g.:
+//    (signature (hash sha256 |...|) (public-key ...) |...|)
+// The public key of signer must be of a type supported by
+// NewPublicKey.  Whatever the algorithm, it is the hash which is
+// signed: Ed25519 signs its 32 bytes as its message.
+func Sign(s sexprs.Sexp, signer crypto.Signer) (*Signature, error) {
+	key, err := NewPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	hash, err := NewHash(s, "sha256")
+	if err != nil {
+		return nil, err
+	}
+	opts := crypto.SHA256
+	if key.Algorithm == "ed25519" {
+		opts = crypto.Hash(0)
+	}
+	value, err := signer.Sign(rand.Reader, hash.Digest, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't sign")
+	}
+	return &Signature{Hash: *hash, Signer: Principal{Key: key}, Value: value}, nil
+}
+
+// Verify checks that sig is a valid signature of s by signer, the
+// principal which the caller expects to have signed it, returning an
+// error if it is not.  The public key named in sig must be signer, or
+// hash to it, and sig must use the hash algorithm of that key's
+// algorithm: a signature is never trusted to say who made it, or how.
+func Verify(s sexprs.Sexp, sig *Signature, signer Principal) error {
+	return verify(s.Pack(), sig, signer)
+}
+
+// VerifyCanonical checks that sig is a valid signature of b, which
+// must be the canonical representation of a single S-expression, by
+// signer, as Verify does.  Non-canonical input is rejected even if it
+// is what was signed, so that the bytes verified are always those of
+// the S-expression which the caller reads from b.
+func VerifyCanonical(b []byte, sig *Signature, signer Principal) error {
+	if _, err := sexprs.ParseCanonical(b); err != nil {
+		return errors.Wrap(err, "signed data not canonical")
+	}
+	return verify(b, sig, signer)
+}
+
+func verify(b []byte, sig *Signature, signer Principal) error {
+	if sig.Signer.Key == nil {
+		return errors.New("signature names no public key")
+	}
+	if !signer.Matches(sig.Signer) {
+		return errors.Wrap(ErrBadSignature, "signed by another principal")
+	}
+	pub, err := sig.Signer.Key.CryptoPublicKey()
+	if err != nil {
+		return err
+	}
+	if alg := signatureHashes[sig.Signer.Key.Algorithm]; sig.Hash.Algorithm != alg {
+		return errors.Wrapf(ErrBadSignature, "%s hash for %s key", sig.Hash.Algorithm, sig.Signer.Key.Algorithm)
+	}
+	hash, err := hashBytes(b, sig.Hash.Algorithm)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hash.Digest, sig.Hash.Digest) {
+		return errors.Wrap(ErrBadSignature, "hash mismatch")
+	}
+	var ok bool
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, hash.Digest, sig.Value)
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(pub, hash.Digest, sig.Value)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(pub, hashes[sig.Hash.Algorithm], hash.Digest, sig.Value) == nil
+	}
+	if !ok {
+		return ErrBadSignature
+	}
+	return nil
+}
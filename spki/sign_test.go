@@ -0,0 +1,149 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+
+	"github.com/eadmund/sexprs"
+)
+
+func testSigners(t *testing.T) map[string]crypto.Signer {
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{"ed25519": ed, "p256": p256, "p384": p384, "rsa": r}
+}
+
+func TestSignVerify(t *testing.T) {
+	s := parse(t, "(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)))")
+	other := parse(t, "(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #03#)) (tag (*)))")
+	for name, signer := range testSigners(t) {
+		sig, err := Sign(s, signer)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		// the signature survives a round trip through its canonical form
+		packed, err := sexprs.Marshal(sig)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		unpacked, err := sexprs.ParseCanonical(packed.Pack())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sig = &Signature{}
+		if err = sig.UnmarshalSexp(unpacked); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		key, _ := NewPublicKey(signer.Public())
+		expected := Principal{Key: key}
+		if err = Verify(s, sig, expected); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if err = VerifyCanonical(s.Pack(), sig, expected); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		bare, _ := sexprs.Marshal(key)
+		keyHash, _ := NewHash(bare, "sha256")
+		if err = Verify(s, sig, Principal{Hash: keyHash}); err != nil {
+			t.Errorf("%s: by hash: %v", name, err)
+		}
+		if err = Verify(other, sig, expected); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected ErrBadSignature for other object; got %v", name, err)
+		}
+		// a forged hash does not help
+		forged := *sig
+		hash, _ := NewHash(other, "sha256")
+		forged.Hash = *hash
+		if err = Verify(other, &forged, expected); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected ErrBadSignature for forged hash; got %v", name, err)
+		}
+		// nor does another hash algorithm
+		forged = *sig
+		hash, _ = NewHash(s, "sha512")
+		forged.Hash = *hash
+		if err = Verify(s, &forged, expected); !errors.Is(err, ErrBadSignature) {
+			t.Errorf("%s: expected ErrBadSignature for sha512 hash; got %v", name, err)
+		}
+		// nor does another key of the same type
+		for otherName, otherSigner := range testSigners(t) {
+			if otherName != name {
+				continue
+			}
+			forged = *sig
+			forged.Signer.Key, _ = NewPublicKey(otherSigner.Public())
+			if err = Verify(s, &forged, expected); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("%s: expected ErrBadSignature for other key; got %v", name, err)
+			}
+			// even when it signed the object itself
+			own, err := Sign(s, otherSigner)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if err = Verify(s, own, expected); !errors.Is(err, ErrBadSignature) {
+				t.Errorf("%s: expected ErrBadSignature for another signer; got %v", name, err)
+			}
+		}
+	}
+}
+
+func TestVerifyCanonicalRejects(t *testing.T) {
+	s := parse(t, "(a b)")
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+	sig, err := Sign(s, ed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{"(a b)", "(1:a 1:b)", "(1:a1:b) "} {
+		// hash the non-canonical input as if it had been signed
+		forged := *sig
+		hash, _ := hashBytes([]byte(input), "sha256")
+		forged.Hash = *hash
+		if err = VerifyCanonical([]byte(input), &forged, sig.Signer); err == nil || errors.Is(err, ErrBadSignature) {
+			t.Errorf("%q: expected non-canonical error; got %v", input, err)
+		}
+	}
+}
+
+func TestPublicKeyRoundTrip(t *testing.T) {
+	for name, signer := range testSigners(t) {
+		k, err := NewPublicKey(signer.Public())
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := k.CryptoPublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()) {
+			t.Errorf("%s: key changed in round trip", name)
+		}
+	}
+	bad := PublicKey{Algorithm: "ecdsa-sha256", Params: []Param{{"curve", []byte("p256")}, {"x", []byte{1}}, {"y", []byte{2}}}}
+	if _, err := bad.CryptoPublicKey(); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed for point not on curve; got %v", err)
+	}
+}
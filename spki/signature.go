@@ -0,0 +1,98 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"github.com/eadmund/sexprs"
+)
+
+// A Signature is the signature by a principal of the object with the
+// given hash, e.g.:
+//    (signature (hash sha256 |...|) (public-key ...) |...|)
+type Signature struct {
+	Hash   Hash
+	Signer Principal
+	Value  []byte
+}
+
+// MarshalSexp implements sexprs.Marshaler.
+func (s Signature) MarshalSexp() (sexprs.Sexp, error) {
+	hash, err := s.Hash.MarshalSexp()
+	if err != nil {
+		return nil, err
+	}
+	signer, err := s.Signer.MarshalSexp()
+	if err != nil {
+		return nil, err
+	}
+	return list("signature", hash, signer, atom(s.Value)), nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (s *Signature) UnmarshalSexp(sexp sexprs.Sexp) error {
+	rest, err := expect(sexp, "signature")
+	if err != nil {
+		return err
+	}
+	if len(rest) != 3 {
+		return malformed("expected (signature hash principal value); got %s", sexp)
+	}
+	var parsed Signature
+	if err = parsed.Hash.UnmarshalSexp(rest[0]); err != nil {
+		return err
+	}
+	if err = parsed.Signer.UnmarshalSexp(rest[1]); err != nil {
+		return err
+	}
+	value, err := octets(rest[2], "signature value")
+	if err != nil {
+		return err
+	}
+	parsed.Value = append([]byte{}, value...)
+	*s = parsed
+	return nil
+}
+
+// A Sequence is a sequence of SPKI objects, such as a chain of certs
+// together with the signatures and keys needed to check them, e.g.:
+//    (sequence (cert ...) (signature ...) (public-key ...))
+type Sequence []Object
+
+// MarshalSexp implements sexprs.Marshaler.
+func (seq Sequence) MarshalSexp() (sexprs.Sexp, error) {
+	l := list("sequence")
+	for _, o := range seq {
+		if _, ok := o.(Sequence); ok {
+			return nil, malformed("nested sequence")
+		}
+		s, err := o.MarshalSexp()
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, s)
+	}
+	return l, nil
+}
+
+// UnmarshalSexp implements sexprs.Unmarshaler.
+func (seq *Sequence) UnmarshalSexp(s sexprs.Sexp) error {
+	rest, err := expect(s, "sequence")
+	if err != nil {
+		return err
+	}
+	parsed := Sequence{}
+	for _, element := range rest {
+		if name, _ := head(element); name == "sequence" {
+			return malformed("nested sequence")
+		}
+		o, err := Parse(element)
+		if err != nil {
+			return err
+		}
+		parsed = append(parsed, o)
+	}
+	*seq = parsed
+	return nil
+}
@@ -0,0 +1,127 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+// Package spki implements the objects of the Simple Public Key
+// Infrastructure (c.f. RFC 2693 and
+// http://theworld.com/~cme/spki.txt), from which canonical
+// S-expressions come: public keys, hashes, signatures, certificates
+// and sequences.  Each is built on sexprs.List and sexprs.Atom, and
+// implements sexprs.Marshaler and sexprs.Unmarshaler, so that e.g.:
+//
+//    s, _ := sexprs.Marshal(cert)
+//    b := s.Pack()
+//
+// yields the canonical bytes of cert, and Parse or UnmarshalSexp
+// reverse the process.  Any S-expression which is parsed without
+// error marshals back to the same S-expression.
+//
+// Sign and Verify sign and verify the canonical representations of
+// arbitrary S-expressions with the standard library's Ed25519, ECDSA
+// and RSA keys.
+//
+// The atoms of SPKI objects, such as algorithm names and key
+// parameters, may not carry display hints.
+package spki
+
+import (
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+// ErrMalformed is reported by errors.Is for every S-expression which
+// is not a well-formed SPKI object.
+var ErrMalformed = errors.New("malformed SPKI object")
+
+// An Object is a top-level SPKI object: a *PublicKey, *Hash,
+// *Signature, *Cert or Sequence.
+type Object interface {
+	sexprs.Marshaler
+}
+
+// Parse returns the SPKI object s, according to the type named at its
+// head.
+func Parse(s sexprs.Sexp) (Object, error) {
+	var o interface {
+		Object
+		sexprs.Unmarshaler
+	}
+	switch name, _ := head(s); name {
+	case "public-key":
+		o = &PublicKey{}
+	case "hash":
+		o = &Hash{}
+	case "signature":
+		o = &Signature{}
+	case "cert":
+		o = &Cert{}
+	case "sequence":
+		o = &Sequence{}
+	default:
+		return nil, malformed("unknown object %s", s)
+	}
+	if err := o.UnmarshalSexp(s); err != nil {
+		return nil, err
+	}
+	if seq, ok := o.(*Sequence); ok {
+		return *seq, nil
+	}
+	return o, nil
+}
+
+func malformed(format string, args ...interface{}) error {
+	return errors.Wrapf(ErrMalformed, format, args...)
+}
+
+// head returns the name at the head of the list s, and the rest of s.
+func head(s sexprs.Sexp) (string, sexprs.List) {
+	l, ok := s.(sexprs.List)
+	if !ok || len(l) == 0 {
+		return "", nil
+	}
+	a, ok := l[0].(sexprs.Atom)
+	if !ok || len(a.DisplayHint) > 0 {
+		return "", nil
+	}
+	return string(a.Value), l[1:]
+}
+
+// expect returns the rest of s, which must be a list headed by name.
+func expect(s sexprs.Sexp, name string) (sexprs.List, error) {
+	h, rest := head(s)
+	if h != name || rest == nil {
+		return nil, malformed("expected (%s ...); got %s", name, s)
+	}
+	return rest, nil
+}
+
+// octets returns the value of atom s, which must have no display hint.
+func octets(s sexprs.Sexp, what string) ([]byte, error) {
+	a, ok := s.(sexprs.Atom)
+	if !ok || len(a.DisplayHint) > 0 {
+		return nil, malformed("expected %s; got %s", what, s)
+	}
+	return a.Value, nil
+}
+
+// token returns the value of atom s as a non-empty string.
+func token(s sexprs.Sexp, what string) (string, error) {
+	b, err := octets(s, what)
+	if err != nil {
+		return "", err
+	}
+	if len(b) == 0 {
+		return "", malformed("empty %s", what)
+	}
+	return string(b), nil
+}
+
+// atom returns an atom of b, which is copied.
+func atom(b []byte) sexprs.Atom {
+	return sexprs.Atom{Value: append([]byte{}, b...)}
+}
+
+// list returns a list headed by name.
+func list(name string, elements ...sexprs.Sexp) sexprs.List {
+	return append(sexprs.List{sexprs.Atom{Value: []byte(name)}}, elements...)
+}
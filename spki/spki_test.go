@@ -0,0 +1,110 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eadmund/sexprs"
+)
+
+func parse(t *testing.T, s string) sexprs.Sexp {
+	sexp, _, err := sexprs.Parse([]byte(s))
+	if err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return sexp
+}
+
+func TestParseRoundTrip(t *testing.T) {
+	for _, input := range []string{
+		"(hash sha256 |n4bQgYhMfWWaL+qgxVrQFaO/TxsrC4Is0V1sFbDwCgg=|)",
+		"(hash md5 #0123# (uri http://example.com/key ftp://example.com/key))",
+		"(public-key (rsa-pkcs1-sha256 (e #010001#) (n |AMc3|)))",
+		"(public-key (ed25519 (q |AAEC|)) (uri http://example.com/))",
+		"(signature (hash sha256 #00#) (public-key (ed25519 (q #01#))) |c2ln|)",
+		"(signature (hash sha256 #00#) (hash sha256 #02#) |c2ln|)",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)))",
+		`(cert (version #00#) (display "text/plain") (issuer (public-key (ed25519 (q #01#))))
+		       (subject (name (hash sha256 #02#) alice mother)) (propagate)
+		       (tag (ftp (* set ftp.example.com ftp.example.org) (* prefix /pub/)))
+		       (valid (not-before "2013-01-01_00:00:00") (not-after "2014-01-01_00:00:00"))
+		       (comment "for testing"))`,
+		"(cert (issuer (hash sha256 #01#)) (subject (name bob)) (tag (read)) (valid (not-after \"2014-01-01_00:00:00\")))",
+		"(sequence (public-key (ed25519 (q #01#))) (cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*))) (signature (hash sha256 #00#) (hash sha256 #01#) #02#))",
+		"(sequence)",
+	} {
+		s := parse(t, input)
+		o, err := Parse(s)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		out, err := sexprs.Marshal(o)
+		if err != nil {
+			t.Errorf("%s: %v", input, err)
+			continue
+		}
+		if !out.Equal(s) {
+			t.Errorf("%s\nround-tripped as %s", s, out)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	for _, input := range []string{
+		"foo",
+		"(foo)",
+		"(hash sha256)",
+		"(hash sha256 #00# #01#)",
+		"(hash (sha256) #00#)",
+		"(hash sha256 [bin]#00#)",
+		"(hash sha256 #00# (uri))",
+		"(public-key)",
+		"(public-key rsa)",
+		"(public-key (rsa (e)))",
+		"(public-key (rsa (e #01# #02#)))",
+		"(public-key (rsa (e (x))))",
+		"(signature (hash sha256 #00#) (public-key (ed25519 (q #01#))))",
+		"(signature (hash sha256 #00#) (name alice) #00#)",
+		"(cert (subject (hash sha256 #02#)) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)))",
+		"(cert (subject (hash sha256 #02#)) (issuer (hash sha256 #01#)) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (foo))",
+		"(cert (issuer (hash sha256 #01#)) (subject (name)) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (propagate yes) (tag (*)))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (valid (not-after yesterday)))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (valid (not-after \"0001-01-01_00:00:00\")))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (valid (not-after \"2014-01-01_00:00:00.5\")))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (comment \"\"))",
+		"(cert (issuer (hash sha256 #01#)) (subject (hash sha256 #02#)) (tag (*)) (valid (not-after \"2014-01-01_00:00:00\") (not-before \"2013-01-01_00:00:00\")))",
+		"(sequence (sequence))",
+		"(sequence (foo))",
+	} {
+		if _, err := Parse(parse(t, input)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: expected ErrMalformed; got %v", input, err)
+		}
+	}
+}
+
+func TestMarshalRejects(t *testing.T) {
+	for _, o := range []Object{
+		&Hash{},
+		&PublicKey{},
+		&PublicKey{Algorithm: "rsa", Params: []Param{{Value: []byte{1}}}},
+		&Signature{Hash: Hash{Algorithm: "sha256"}},
+		&Signature{Hash: Hash{Algorithm: "sha256"}, Signer: Principal{Key: &PublicKey{Algorithm: "ed25519"}, Hash: &Hash{Algorithm: "sha256"}}},
+		&Cert{Issuer: Principal{Hash: &Hash{Algorithm: "sha256"}}, Subject: Subject{Name: &Name{}}, Tag: sexprs.List{}},
+		&Cert{Issuer: Principal{Hash: &Hash{Algorithm: "sha256"}}, Subject: Subject{Name: &Name{Names: []string{"alice"}}}},
+		Sequence{Sequence{}},
+	} {
+		if _, err := o.MarshalSexp(); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%#v: expected ErrMalformed; got %v", o, err)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"bytes"
+	"math/big"
+	"time"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+// This file implements the algebra of tags, which describe the
+// authority granted by certs.  A tag denotes a set of S-expressions:
+//
+//    an atom              that atom alone
+//    a list (x y ...)     every list (x' y' ...) at least as long,
+//                         whose elements are in the sets denoted by
+//                         the corresponding x, y, ...
+//    (*)                  every S-expression
+//    (* set a b ...)      the union of the sets denoted by a, b, ...
+//    (* prefix p)         every atom whose value begins with p
+//    (* range o ...)      every atom whose value is within a range
+//                         under the ordering o, e.g.
+//                         (* range numeric ge "10" l "20")
+//
+// The orderings of ranges are alpha (by bytes), numeric (by decimal
+// value), binary (as unsigned big-endian integers) and time or date (as
+// SPKI dates, in DateFormat).  Each of the lower limits g and ge and
+// upper limits l and le is optional.  Display hints are ignored by
+// prefixes and ranges, but must match for atoms to be equal.
+
+// ErrNotRepresentable is reported by Intersect when the intersection
+// of two tags, such as a prefix and a range, cannot be written as a
+// tag.
+var ErrNotRepresentable = errors.New("intersection not representable as a tag")
+
+// Intersect returns the tag denoting the S-expressions denoted by both
+// a and b, or nil if there are none.  It is used to compute the
+// authority delegated along a chain of certs.
+func Intersect(a, b sexprs.Sexp) (sexprs.Sexp, error) {
+	ta, err := parseTag(a)
+	if err != nil {
+		return nil, err
+	}
+	tb, err := parseTag(b)
+	if err != nil {
+		return nil, err
+	}
+	t, err := intersect(ta, tb)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	return t.sexp(), nil
+}
+
+// Implies reports whether every S-expression denoted by a is denoted
+// by b, i.e. whether authority b suffices for a request a, e.g.:
+//    Implies((ftp ftp.example.com /pub/x), (ftp (* set ftp.example.com)))
+// is true.  Where this cannot be decided without enumerating the sets
+// denoted, e.g. whether a prefix lies within a range, Implies returns
+// false.
+func Implies(a, b sexprs.Sexp) (bool, error) {
+	ta, err := parseTag(a)
+	if err != nil {
+		return false, err
+	}
+	tb, err := parseTag(b)
+	if err != nil {
+		return false, err
+	}
+	return implies(ta, tb)
+}
+
+type tagKind int
+
+const (
+	tagAtom tagKind = iota
+	tagList
+	tagAll
+	tagSet
+	tagPrefix
+	tagRange
+)
+
+// A tag is a parsed tag.
+type tag struct {
+	kind     tagKind
+	atom     sexprs.Atom // of an atom
+	elements []*tag      // of a list, or the members of a set
+	prefix   []byte
+	ordering string
+	lower    *limit
+	upper    *limit
+}
+
+// A limit is a bound of a range.
+type limit struct {
+	value     []byte
+	inclusive bool
+}
+
+var star = sexprs.Atom{Value: []byte("*")}
+
+func parseTag(s sexprs.Sexp) (*tag, error) {
+	switch s := s.(type) {
+	case sexprs.Atom:
+		return &tag{kind: tagAtom, atom: s}, nil
+	case sexprs.List:
+		if len(s) > 0 && s[0].Equal(star) {
+			return parseStar(s)
+		}
+		t := &tag{kind: tagList}
+		for _, element := range s {
+			e, err := parseTag(element)
+			if err != nil {
+				return nil, err
+			}
+			t.elements = append(t.elements, e)
+		}
+		return t, nil
+	}
+	return nil, malformed("expected tag; got %s", s)
+}
+
+func parseStar(s sexprs.List) (*tag, error) {
+	if len(s) == 1 {
+		return &tag{kind: tagAll}, nil
+	}
+	form, err := token(s[1], "star form")
+	if err != nil {
+		return nil, err
+	}
+	args := s[2:]
+	switch form {
+	case "set":
+		t := &tag{kind: tagSet}
+		for _, member := range args {
+			m, err := parseTag(member)
+			if err != nil {
+				return nil, err
+			}
+			t.elements = append(t.elements, m)
+		}
+		return t, nil
+	case "prefix":
+		if len(args) != 1 {
+			return nil, malformed("expected (* prefix value); got %s", s)
+		}
+		p, err := octets(args[0], "prefix")
+		if err != nil {
+			return nil, err
+		}
+		return &tag{kind: tagPrefix, prefix: p}, nil
+	case "range":
+		return parseRange(s, args)
+	}
+	return nil, malformed("unknown star form %s", s)
+}
+
+func parseRange(s sexprs.List, args sexprs.List) (*tag, error) {
+	if len(args) == 0 {
+		return nil, malformed("range without ordering: %s", s)
+	}
+	ordering, err := token(args[0], "range ordering")
+	if err != nil {
+		return nil, err
+	}
+	switch ordering {
+	case "alpha", "numeric", "binary", "time", "date":
+	default:
+		return nil, malformed("unknown range ordering %q", ordering)
+	}
+	t := &tag{kind: tagRange, ordering: ordering}
+	args = args[1:]
+	for len(args) > 0 {
+		if len(args) < 2 {
+			return nil, malformed("range limit without value: %s", s)
+		}
+		op, err := token(args[0], "range limit")
+		if err != nil {
+			return nil, err
+		}
+		value, err := octets(args[1], "range limit value")
+		if err != nil {
+			return nil, err
+		}
+		// check that value is valid for the ordering
+		if _, err = compare(ordering, value, value); err != nil {
+			return nil, err
+		}
+		l := &limit{value: value, inclusive: op == "ge" || op == "le"}
+		switch {
+		case (op == "g" || op == "ge") && t.lower == nil && t.upper == nil:
+			t.lower = l
+		case (op == "l" || op == "le") && t.upper == nil:
+			t.upper = l
+		default:
+			return nil, malformed("unexpected range limit %q in %s", op, s)
+		}
+		args = args[2:]
+	}
+	return t, nil
+}
+
+// compare compares a and b under ordering.
+func compare(ordering string, a, b []byte) (int, error) {
+	switch ordering {
+	case "alpha":
+		return bytes.Compare(a, b), nil
+	case "binary":
+		a, b = bytes.TrimLeft(a, "\x00"), bytes.TrimLeft(b, "\x00")
+		if len(a) != len(b) {
+			if len(a) < len(b) {
+				return -1, nil
+			}
+			return 1, nil
+		}
+		return bytes.Compare(a, b), nil
+	case "numeric":
+		x, ok := new(big.Rat).SetString(string(a))
+		if !ok {
+			return 0, malformed("bad number %q", a)
+		}
+		y, ok := new(big.Rat).SetString(string(b))
+		if !ok {
+			return 0, malformed("bad number %q", b)
+		}
+		return x.Cmp(y), nil
+	case "time", "date":
+		x, err := time.Parse(DateFormat, string(a))
+		if err != nil {
+			return 0, malformed("bad date %q", a)
+		}
+		y, err := time.Parse(DateFormat, string(b))
+		if err != nil {
+			return 0, malformed("bad date %q", b)
+		}
+		switch {
+		case x.Before(y):
+			return -1, nil
+		case x.After(y):
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, errors.Errorf("unknown ordering %q", ordering)
+}
+
+func (t *tag) sexp() sexprs.Sexp {
+	switch t.kind {
+	case tagAtom:
+		return t.atom
+	case tagList:
+		l := sexprs.List{}
+		for _, e := range t.elements {
+			l = append(l, e.sexp())
+		}
+		return l
+	case tagAll:
+		return sexprs.List{star}
+	case tagSet:
+		l := list("*", atom([]byte("set")))
+		for _, m := range t.elements {
+			l = append(l, m.sexp())
+		}
+		return l
+	case tagPrefix:
+		return list("*", atom([]byte("prefix")), atom(t.prefix))
+	}
+	l := list("*", atom([]byte("range")), atom([]byte(t.ordering)))
+	if t.lower != nil {
+		op := "g"
+		if t.lower.inclusive {
+			op = "ge"
+		}
+		l = append(l, atom([]byte(op)), atom(t.lower.value))
+	}
+	if t.upper != nil {
+		op := "l"
+		if t.upper.inclusive {
+			op = "le"
+		}
+		l = append(l, atom([]byte(op)), atom(t.upper.value))
+	}
+	return l
+}
+
+// contains reports whether range t contains value.
+func (t *tag) contains(value []byte) bool {
+	if t.lower != nil {
+		c, err := compare(t.ordering, value, t.lower.value)
+		if err != nil {
+			// a value which cannot be ordered is not in the range
+			return false
+		}
+		if c < 0 || c == 0 && !t.lower.inclusive {
+			return false
+		}
+	}
+	if t.upper != nil {
+		c, err := compare(t.ordering, value, t.upper.value)
+		if err != nil {
+			return false
+		}
+		if c > 0 || c == 0 && !t.upper.inclusive {
+			return false
+		}
+	}
+	return true
+}
+
+// union returns the union of tags, or nil if there are none.
+func union(tags []*tag) *tag {
+	var members []*tag
+	for _, t := range tags {
+		switch {
+		case t == nil:
+		case t.kind == tagSet:
+			members = append(members, t.elements...)
+		default:
+			members = append(members, t)
+		}
+	}
+	switch len(members) {
+	case 0:
+		return nil
+	case 1:
+		return members[0]
+	}
+	return &tag{kind: tagSet, elements: members}
+}
+
+// intersect returns the intersection of a and b, or nil if it is
+// empty.
+func intersect(a, b *tag) (*tag, error) {
+	switch {
+	case a.kind == tagAll:
+		return b, nil
+	case b.kind == tagAll:
+		return a, nil
+	case a.kind == tagSet:
+		return intersectSet(a, b)
+	case b.kind == tagSet:
+		return intersectSet(b, a)
+	case a.kind == tagList || b.kind == tagList:
+		if a.kind != b.kind {
+			return nil, nil
+		}
+		return intersectList(a, b)
+	case a.kind == tagAtom:
+		if ok, err := implies(a, b); !ok || err != nil {
+			return nil, err
+		}
+		return a, nil
+	case b.kind == tagAtom:
+		return intersect(b, a)
+	case a.kind == tagPrefix && b.kind == tagPrefix:
+		switch {
+		case bytes.HasPrefix(a.prefix, b.prefix):
+			return a, nil
+		case bytes.HasPrefix(b.prefix, a.prefix):
+			return b, nil
+		}
+		return nil, nil
+	case a.kind == tagRange && b.kind == tagRange && a.ordering == b.ordering:
+		return intersectRange(a, b)
+	}
+	return nil, errors.Wrapf(ErrNotRepresentable, "%s and %s", a.sexp(), b.sexp())
+}
+
+func intersectSet(set, t *tag) (*tag, error) {
+	var results []*tag
+	for _, m := range set.elements {
+		r, err := intersect(m, t)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return union(results), nil
+}
+
+func intersectList(a, b *tag) (*tag, error) {
+	if len(a.elements) < len(b.elements) {
+		a, b = b, a
+	}
+	t := &tag{kind: tagList}
+	for i, e := range a.elements {
+		if i >= len(b.elements) {
+			t.elements = append(t.elements, e)
+			continue
+		}
+		r, err := intersect(e, b.elements[i])
+		if err != nil || r == nil {
+			return nil, err
+		}
+		t.elements = append(t.elements, r)
+	}
+	return t, nil
+}
+
+func intersectRange(a, b *tag) (*tag, error) {
+	t := &tag{kind: tagRange, ordering: a.ordering, lower: a.lower, upper: a.upper}
+	if b.lower != nil {
+		if t.lower == nil {
+			t.lower = b.lower
+		} else {
+			c, err := compare(t.ordering, b.lower.value, t.lower.value)
+			if err != nil {
+				return nil, err
+			}
+			if c > 0 || c == 0 && !b.lower.inclusive {
+				t.lower = b.lower
+			}
+		}
+	}
+	if b.upper != nil {
+		if t.upper == nil {
+			t.upper = b.upper
+		} else {
+			c, err := compare(t.ordering, b.upper.value, t.upper.value)
+			if err != nil {
+				return nil, err
+			}
+			if c < 0 || c == 0 && !b.upper.inclusive {
+				t.upper = b.upper
+			}
+		}
+	}
+	if t.lower != nil && t.upper != nil {
+		c, err := compare(t.ordering, t.lower.value, t.upper.value)
+		if err != nil {
+			return nil, err
+		}
+		if c > 0 || c == 0 && !(t.lower.inclusive && t.upper.inclusive) {
+			return nil, nil
+		}
+	}
+	return t, nil
+}
+
+// implies reports whether a is a subset of b.
+func implies(a, b *tag) (bool, error) {
+	switch {
+	case b.kind == tagAll:
+		return true, nil
+	case a.kind == tagSet:
+		for _, m := range a.elements {
+			if ok, err := implies(m, b); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case b.kind == tagSet:
+		for _, m := range b.elements {
+			if ok, err := implies(a, m); ok || err != nil {
+				return ok, err
+			}
+		}
+		return false, nil
+	case a.kind == tagList && b.kind == tagList:
+		if len(a.elements) < len(b.elements) {
+			return false, nil
+		}
+		for i, e := range b.elements {
+			if ok, err := implies(a.elements[i], e); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	case a.kind == tagAtom:
+		switch b.kind {
+		case tagAtom:
+			return a.atom.Equal(b.atom), nil
+		case tagPrefix:
+			return bytes.HasPrefix(a.atom.Value, b.prefix), nil
+		case tagRange:
+			return b.contains(a.atom.Value), nil
+		}
+	case a.kind == tagPrefix && b.kind == tagPrefix:
+		return bytes.HasPrefix(a.prefix, b.prefix), nil
+	case a.kind == tagRange && b.kind == tagRange && a.ordering == b.ordering:
+		r, err := intersectRange(a, b)
+		if err != nil || r == nil {
+			return false, err
+		}
+		// a is within b if intersecting with b leaves it unchanged
+		return r.lower == a.lower && r.upper == a.upper, nil
+	}
+	return false, nil
+}
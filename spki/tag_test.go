@@ -0,0 +1,110 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIntersect(t *testing.T) {
+	for _, test := range []struct {
+		a, b, expected string // an empty expected means no intersection
+	}{
+		{"(*)", "(ftp host)", "(ftp host)"},
+		{"(ftp host)", "(*)", "(ftp host)"},
+		{"foo", "foo", "foo"},
+		{"foo", "bar", ""},
+		{"[text]foo", "foo", ""},
+		{"(ftp host)", "(ftp host /pub)", "(ftp host /pub)"},
+		{"(ftp host /pub)", "(ftp other)", ""},
+		{"(ftp host)", "ftp", ""},
+		{"(ftp (* set a b c))", "(ftp (* set b c d))", "(ftp (* set b c))"},
+		{"(* set a b)", "(* set c d)", ""},
+		{"(* set a (* prefix /pub/))", "/pub/x", "/pub/x"},
+		{"(* prefix /pub/)", "(* prefix /pub/x/)", "(* prefix /pub/x/)"},
+		{"(* prefix /pub/)", "(* prefix /priv/)", ""},
+		{"(* prefix /pub/)", "/priv/x", ""},
+		{`(* range numeric ge "10" l "20")`, `(* range numeric g "15")`, `(* range numeric g "15" l "20")`},
+		{`(* range numeric ge "10" l "20")`, `(* range numeric ge "20")`, ""},
+		{`(* range numeric ge "10" le "20")`, `(* range numeric ge "20")`, `(* range numeric ge "20" le "20")`},
+		{`(* range numeric ge "10" l "20")`, `"15"`, `"15"`},
+		{`(* range numeric ge "10" l "20")`, `"9.5"`, ""},
+		{`(* range numeric ge "10" l "20")`, "x", ""},
+		{"(* range alpha ge b l d)", "cat", "cat"},
+		{"(* range binary ge #0100#)", "#00ff#", ""},
+		{"(* range binary ge #0100#)", "#000100#", "#000100#"},
+		{`(* range time ge "2013-01-01_00:00:00")`, `(* range time l "2014-01-01_00:00:00")`,
+			`(* range time ge "2013-01-01_00:00:00" l "2014-01-01_00:00:00")`},
+	} {
+		result, err := Intersect(parse(t, test.a), parse(t, test.b))
+		if err != nil {
+			t.Errorf("%s ∩ %s: %v", test.a, test.b, err)
+			continue
+		}
+		switch {
+		case test.expected == "" && result != nil:
+			t.Errorf("%s ∩ %s: expected nothing; got %s", test.a, test.b, result)
+		case test.expected != "" && (result == nil || !result.Equal(parse(t, test.expected))):
+			t.Errorf("%s ∩ %s: expected %s; got %v", test.a, test.b, test.expected, result)
+		}
+	}
+}
+
+func TestIntersectErrors(t *testing.T) {
+	for _, test := range []struct {
+		a, b string
+		err  error
+	}{
+		{"(* prefix a)", "(* range alpha ge a)", ErrNotRepresentable},
+		{"(* range alpha ge a)", `(* range numeric ge "1")`, ErrNotRepresentable},
+		{"(* foo)", "a", ErrMalformed},
+		{"(* prefix)", "a", ErrMalformed},
+		{"(* range)", "a", ErrMalformed},
+		{"(* range sideways)", "a", ErrMalformed},
+		{"(* range numeric ge)", "a", ErrMalformed},
+		{"(* range numeric ge x)", "a", ErrMalformed},
+		{`(* range numeric l "1" g "0")`, "a", ErrMalformed},
+		{"(* range time ge tomorrow)", "a", ErrMalformed},
+	} {
+		if _, err := Intersect(parse(t, test.a), parse(t, test.b)); !errors.Is(err, test.err) {
+			t.Errorf("%s ∩ %s: expected %v; got %v", test.a, test.b, test.err, err)
+		}
+	}
+}
+
+func TestImplies(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected bool
+	}{
+		{"(ftp host /pub/x)", "(ftp host)", true},
+		{"(ftp host)", "(ftp host /pub/x)", false},
+		{"(ftp host)", "(*)", true},
+		{"(*)", "(ftp host)", false},
+		{"(ftp ftp.example.com /pub/x)", "(ftp (* set ftp.example.com))", true},
+		{"(ftp (* set a b))", "(ftp (* set a b c))", true},
+		{"(ftp (* set a d))", "(ftp (* set a b c))", false},
+		{"/pub/x", "(* prefix /pub/)", true},
+		{"(* prefix /pub/x)", "(* prefix /pub/)", true},
+		{"(* prefix /pub/)", "(* prefix /pub/x)", false},
+		{`"15"`, `(* range numeric ge "10" l "20")`, true},
+		{`"20"`, `(* range numeric ge "10" l "20")`, false},
+		{`(* range numeric g "10" l "20")`, `(* range numeric ge "10" le "20")`, true},
+		{`(* range numeric ge "10" le "20")`, `(* range numeric g "10" le "20")`, false},
+		{`(* range numeric ge "12")`, `(* range numeric ge "10" le "20")`, false},
+		{"(* prefix a)", "(* range alpha ge a)", false},
+		{"a", "b", false},
+	} {
+		ok, err := Implies(parse(t, test.a), parse(t, test.b))
+		if err != nil {
+			t.Errorf("%s ⊆ %s: %v", test.a, test.b, err)
+			continue
+		}
+		if ok != test.expected {
+			t.Errorf("%s ⊆ %s: expected %v", test.a, test.b, test.expected)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/eadmund/sexprs"
+	"github.com/pkg/errors"
+)
+
+// The reasons for which tuples may fail to reduce, or to authorize a
+// request, reported by errors.Is for a *ReductionError.
+var (
+	ErrEmptyChain      = errors.New("empty chain")
+	ErrSubjectMismatch = errors.New("subject is not the next issuer")
+	ErrNoDelegation    = errors.New("subject may not delegate")
+	ErrUnresolvedName  = errors.New("subject is an unresolved name")
+	ErrEmptyTag        = errors.New("tags have no intersection")
+	ErrEmptyValidity   = errors.New("validity periods do not overlap")
+	ErrNotValid        = errors.New("not valid at the time given")
+	ErrNotAuthorized   = errors.New("request not within tag")
+)
+
+// A ReductionError describes why a chain of tuples could not be
+// reduced, or did not authorize a request.
+type ReductionError struct {
+	Index int   // the index in the chain of the tuple at fault
+	Kind  error // one of the Err variables above, or an error from Intersect
+}
+
+func (e *ReductionError) Error() string {
+	return fmt.Sprintf("tuple %d: %v", e.Index, e.Kind)
+}
+
+// Unwrap returns the kind of the error, so that errors.Is may be used
+// to test it.
+func (e *ReductionError) Unwrap() error {
+	return e.Kind
+}
+
+// A Tuple is the 5-tuple to which a cert reduces (c.f. section 6 of
+// RFC 2693): its issuer grants its subject the authority described by
+// its tag, during its period of validity, and may permit the subject
+// to delegate that authority.  Tuples may also be built directly, e.g.
+// from the entries of an access control list.
+type Tuple struct {
+	Issuer   Principal
+	Subject  Subject
+	Delegate bool
+	Tag      sexprs.Sexp
+	Valid    Validity
+}
+
+// Tuple returns the 5-tuple of c.  The signature of c must have been
+// checked beforehand.
+func (c Cert) Tuple() Tuple {
+	t := Tuple{Issuer: c.Issuer, Subject: c.Subject, Delegate: c.Propagate, Tag: c.Tag}
+	if c.Valid != nil {
+		t.Valid = *c.Valid
+	}
+	return t
+}
+
+// ParseTuple returns the 5-tuple of the cert s.
+func ParseTuple(s sexprs.Sexp) (Tuple, error) {
+	var c Cert
+	if err := c.UnmarshalSexp(s); err != nil {
+		return Tuple{}, err
+	}
+	return c.Tuple(), nil
+}
+
+// Reduce combines a chain of tuples, in which the subject of each is
+// the issuer of the next, into a single tuple: its issuer is that of
+// the first, its subject and delegation those of the last, and its tag
+// and validity the intersections of those of the chain.  Each tuple
+// but the last must permit delegation.  Names are not resolved: a
+// subject which is a name cannot be followed by another tuple.
+func Reduce(chain ...Tuple) (Tuple, error) {
+	if len(chain) == 0 {
+		return Tuple{}, &ReductionError{Index: 0, Kind: ErrEmptyChain}
+	}
+	t := chain[0]
+	for i, next := range chain[1:] {
+		var err error
+		if t, err = reduce(t, next); err != nil {
+			// the subject and delegation of t are those of chain[i];
+			// anything else is the fault of the tuple which follows
+			index := i + 1
+			if err == ErrNoDelegation || err == ErrUnresolvedName {
+				index = i
+			}
+			return Tuple{}, &ReductionError{Index: index, Kind: err}
+		}
+	}
+	return t, nil
+}
+
+func reduce(a, b Tuple) (Tuple, error) {
+	if !a.Delegate {
+		return Tuple{}, ErrNoDelegation
+	}
+	if a.Subject.Principal == nil {
+		return Tuple{}, ErrUnresolvedName
+	}
+	if !a.Subject.Principal.Matches(b.Issuer) {
+		return Tuple{}, ErrSubjectMismatch
+	}
+	tag, err := Intersect(a.Tag, b.Tag)
+	if err != nil {
+		return Tuple{}, err
+	}
+	if tag == nil {
+		return Tuple{}, ErrEmptyTag
+	}
+	valid, ok := a.Valid.Intersect(b.Valid)
+	if !ok {
+		return Tuple{}, ErrEmptyValidity
+	}
+	return Tuple{Issuer: a.Issuer, Subject: b.Subject, Delegate: b.Delegate, Tag: tag, Valid: valid}, nil
+}
+
+// Authorizes checks that t grants subject the authority to make
+// request at time at, returning a *ReductionError with index 0 if not.
+func (t Tuple) Authorizes(subject Principal, request sexprs.Sexp, at time.Time) error {
+	fail := func(kind error) error {
+		return &ReductionError{Index: 0, Kind: kind}
+	}
+	switch {
+	case t.Subject.Principal == nil:
+		return fail(ErrUnresolvedName)
+	case !t.Subject.Principal.Matches(subject):
+		return fail(ErrSubjectMismatch)
+	case !t.Valid.Contains(at):
+		return fail(ErrNotValid)
+	}
+	ok, err := Implies(request, t.Tag)
+	switch {
+	case err != nil:
+		return fail(err)
+	case !ok:
+		return fail(ErrNotAuthorized)
+	}
+	return nil
+}
\ No newline at end of file
@@ -0,0 +1,153 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package spki
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eadmund/sexprs"
+)
+
+func testKey(q byte) *PublicKey {
+	return &PublicKey{Algorithm: "ed25519", Params: []Param{{Name: "q", Value: []byte{q}}}}
+}
+
+func keyHash(t *testing.T, k *PublicKey) *Hash {
+	s, err := k.MarshalSexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHash(s, "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func date(year int) time.Time {
+	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func TestReduce(t *testing.T) {
+	alice, bob, carol := testKey(1), testKey(2), testKey(3)
+	acl := Tuple{
+		Issuer:   Principal{Key: testKey(0)},
+		Subject:  Subject{Principal: &Principal{Key: alice}},
+		Delegate: true,
+		Tag:      parse(t, "(ftp (* set a.example.com b.example.com))"),
+		Valid:    Validity{NotAfter: date(2015)},
+	}
+	// alice's cert names bob by his hash
+	aliceToBob, err := ParseTuple(parse(t, `(cert (issuer (public-key (ed25519 (q #01#))))
+		(subject `+mustString(t, keyHash(t, bob))+`)
+		(propagate) (tag (ftp (* set b.example.com c.example.com)))
+		(valid (not-before "2013-01-01_00:00:00")))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobToCarol := Tuple{
+		Issuer:  Principal{Key: bob},
+		Subject: Subject{Principal: &Principal{Key: carol}},
+		Tag:     parse(t, "(ftp b.example.com (* prefix /pub/))"),
+		Valid:   Validity{NotAfter: date(2014)},
+	}
+	result, err := Reduce(acl, aliceToBob, bobToCarol)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Issuer.Matches(acl.Issuer) || !result.Subject.Principal.Matches(Principal{Key: carol}) || result.Delegate {
+		t.Errorf("bad result %+v", result)
+	}
+	if !result.Tag.Equal(parse(t, "(ftp b.example.com (* prefix /pub/))")) {
+		t.Errorf("bad tag %s", result.Tag)
+	}
+	if result.Valid != (Validity{NotBefore: date(2013), NotAfter: date(2014)}) {
+		t.Errorf("bad validity %+v", result.Valid)
+	}
+	if err = result.Authorizes(Principal{Hash: keyHash(t, carol)}, parse(t, "(ftp b.example.com /pub/x)"), date(2013)); err != nil {
+		t.Error(err)
+	}
+	for _, test := range []struct {
+		subject *PublicKey
+		request string
+		at      time.Time
+		kind    error
+	}{
+		{bob, "(ftp b.example.com /pub/x)", date(2013), ErrSubjectMismatch},
+		{carol, "(ftp b.example.com /priv/x)", date(2013), ErrNotAuthorized},
+		{carol, "(ftp b.example.com)", date(2013), ErrNotAuthorized},
+		{carol, "(ftp b.example.com /pub/x)", date(2012), ErrNotValid},
+		{carol, "(ftp b.example.com /pub/x)", date(2014).Add(time.Second), ErrNotValid},
+	} {
+		err := result.Authorizes(Principal{Key: test.subject}, parse(t, test.request), test.at)
+		if !errors.Is(err, test.kind) {
+			t.Errorf("%s at %v: expected %v; got %v", test.request, test.at, test.kind, err)
+		}
+	}
+}
+
+func mustString(t *testing.T, m sexprs.Marshaler) string {
+	s, err := m.MarshalSexp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.String()
+}
+
+func TestReduceFailures(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	base := Tuple{
+		Issuer:   Principal{Key: testKey(0)},
+		Subject:  Subject{Principal: &Principal{Key: alice}},
+		Delegate: true,
+		Tag:      parse(t, "(ftp a.example.com)"),
+		Valid:    Validity{NotAfter: date(2014)},
+	}
+	next := Tuple{
+		Issuer:  Principal{Key: alice},
+		Subject: Subject{Principal: &Principal{Key: bob}},
+		Tag:     parse(t, "(ftp a.example.com /pub)"),
+	}
+	for _, test := range []struct {
+		name   string
+		modify func(a, b *Tuple)
+		kind   error
+		index  int
+	}{
+		{"no delegation", func(a, b *Tuple) { a.Delegate = false }, ErrNoDelegation, 0},
+		{"wrong issuer", func(a, b *Tuple) { b.Issuer = Principal{Key: bob} }, ErrSubjectMismatch, 1},
+		{"wrong hash", func(a, b *Tuple) { b.Issuer = Principal{Hash: keyHash(t, bob)} }, ErrSubjectMismatch, 1},
+		{"name", func(a, b *Tuple) { a.Subject = Subject{Name: &Name{Names: []string{"alice"}}} }, ErrUnresolvedName, 0},
+		{"tags", func(a, b *Tuple) { b.Tag = parse(t, "(http)") }, ErrEmptyTag, 1},
+		{"validity", func(a, b *Tuple) { b.Valid.NotBefore = date(2015) }, ErrEmptyValidity, 1},
+		{"unrepresentable", func(a, b *Tuple) {
+			a.Tag = parse(t, "(* prefix a)")
+			b.Tag = parse(t, "(* range alpha ge b)")
+		}, ErrNotRepresentable, 1},
+	} {
+		a, b := base, next
+		test.modify(&a, &b)
+		_, err := Reduce(a, b)
+		var re *ReductionError
+		if !errors.As(err, &re) || re.Index != test.index || !errors.Is(err, test.kind) {
+			t.Errorf("%s: expected %v at tuple %d; got %v", test.name, test.kind, test.index, err)
+		}
+	}
+	// the second tuple of three may not delegate
+	third := Tuple{Issuer: Principal{Key: bob}, Subject: Subject{Principal: &Principal{Key: alice}}}
+	_, err := Reduce(base, next, third)
+	var re *ReductionError
+	if !errors.As(err, &re) || re.Index != 1 || !errors.Is(err, ErrNoDelegation) {
+		t.Errorf("expected ErrNoDelegation at tuple 1; got %v", err)
+	}
+	if _, err := Reduce(); !errors.Is(err, ErrEmptyChain) {
+		t.Errorf("expected ErrEmptyChain; got %v", err)
+	}
+	if result, err := Reduce(base); err != nil || !result.Tag.Equal(base.Tag) {
+		t.Errorf("a single tuple should reduce to itself; got %v", err)
+	}
+}
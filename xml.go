@@ -0,0 +1,252 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// xmlAttributes heads the list of an element's attributes.
+const xmlAttributes = "@"
+
+// FromXML converts the XML document b to an S-expression.  Each element
+// becomes a list headed by its name, followed by a list of its
+// attributes, if it has any, and then its content, in order: text as
+// atoms, and elements as lists.  E.g.
+//    <a href="x.html" class="link">see <b>here</b></a>
+// becomes
+//    (a (@ (href x.html) (class link)) "see " (b here))
+// Names keep any namespace prefix, e.g. xsl:template, and namespace
+// declarations are kept as attributes.  Comments, processing
+// instructions and directives are discarded, joining any text around
+// them, and then text consisting only of whitespace is discarded.
+func FromXML(b []byte) (Sexp, error) {
+	d := xml.NewDecoder(bytes.NewReader(b))
+	var (
+		stack []List // the elements being read
+		text  []byte // the text read since the last tag
+		root  Sexp
+	)
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "XML")
+		}
+		switch t.(type) {
+		case xml.StartElement, xml.EndElement:
+			if err = addXMLText(stack, text); err != nil {
+				return nil, err
+			}
+			text = text[:0]
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			if root != nil {
+				return nil, errors.Errorf("XML: offset %d: more than one root element", d.InputOffset())
+			}
+			if max := DefaultLimits.MaxDepth; max > 0 && len(stack) >= max {
+				return nil, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+			}
+			l := List{Atom{Value: []byte(xmlName(t.Name))}}
+			if len(t.Attr) > 0 {
+				attrs := List{Atom{Value: []byte(xmlAttributes)}}
+				seen := make(map[string]bool, len(t.Attr))
+				for _, a := range t.Attr {
+					if seen[xmlName(a.Name)] {
+						return nil, errors.Errorf("XML: offset %d: attribute %s repeated", d.InputOffset(), xmlName(a.Name))
+					}
+					seen[xmlName(a.Name)] = true
+					attrs = append(attrs, List{Atom{Value: []byte(xmlName(a.Name))}, Atom{Value: []byte(a.Value)}})
+				}
+				l = append(l, attrs)
+			}
+			stack = append(stack, l)
+		case xml.EndElement:
+			// RawToken leaves matching elements to its caller
+			if len(stack) == 0 {
+				return nil, errors.Errorf("XML: unexpected end element </%s>", xmlName(t.Name))
+			}
+			l := stack[len(stack)-1]
+			if name := xmlName(t.Name); name != string(l[0].(Atom).Value) {
+				return nil, errors.Errorf("XML: element <%s> closed by </%s>", l[0].(Atom).Value, name)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				root = l
+			} else {
+				stack[len(stack)-1] = append(stack[len(stack)-1], l)
+			}
+		case xml.CharData:
+			// RawToken may split text, e.g. around entities
+			text = append(text, t...)
+		}
+	}
+	if err := addXMLText(stack, text); err != nil {
+		return nil, err
+	}
+	switch {
+	case len(stack) > 0:
+		return nil, errors.Wrapf(io.ErrUnexpectedEOF, "XML: element <%s> unclosed", stack[len(stack)-1][0].(Atom).Value)
+	case root == nil:
+		return nil, errors.New("XML: no root element")
+	}
+	return root, nil
+}
+
+// addXMLText adds text to the element atop stack, unless it consists
+// only of whitespace.
+func addXMLText(stack []List, text []byte) error {
+	if len(bytes.TrimSpace(text)) == 0 {
+		return nil
+	}
+	if len(stack) == 0 {
+		return errors.New("XML: text outside the root element")
+	}
+	stack[len(stack)-1] = append(stack[len(stack)-1], Atom{Value: append([]byte{}, text...)})
+	return nil
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+// ToXML converts s to an XML document, reversing FromXML: s must be a
+// list headed by an element name, optionally followed by a list of
+// attributes headed by @, and then by atoms of text and lists of
+// elements.  It is an error for s to contain anything which FromXML
+// would not convert back to the same S-expression: display hints;
+// atoms which are not UTF-8 or contain characters XML forbids; text
+// which is empty, consists only of whitespace, or adjoins other text;
+// and names which are not XML names.
+func ToXML(s Sexp) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := writeXMLElement(buf, s); err != nil {
+		return nil, errors.Wrap(err, "XML")
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(buf *bytes.Buffer, s Sexp) error {
+	l, ok := s.(List)
+	if !ok {
+		return errors.Errorf("%s is not an element", s)
+	}
+	name, err := xmlNameOf(listElement(l, 0))
+	if err != nil {
+		return errors.Wrapf(err, "element %s", s)
+	}
+	buf.WriteString("<" + name)
+	content := l[1:]
+	if h, ok := head(listElement(l, 1)); ok && string(h) == xmlAttributes {
+		attrs := l[1].(List)[1:]
+		if len(attrs) == 0 {
+			return errors.Errorf("element %s: empty attribute list", name)
+		}
+		for _, attr := range attrs {
+			pair, ok := attr.(List)
+			if !ok || len(pair) != 2 {
+				return errors.Errorf("element %s: attribute %s is not a (name value) list", name, attr)
+			}
+			attrName, err := xmlNameOf(pair[0])
+			if err != nil {
+				return errors.Wrapf(err, "element %s", name)
+			}
+			value, err := xmlText(pair[1])
+			if err != nil {
+				return errors.Wrapf(err, "element %s: attribute %s", name, attrName)
+			}
+			buf.WriteString(" " + attrName + `="`)
+			xml.EscapeText(buf, value)
+			buf.WriteByte('"')
+		}
+		content = l[2:]
+	}
+	if len(content) == 0 {
+		buf.WriteString("/>")
+		return nil
+	}
+	buf.WriteByte('>')
+	for i, element := range content {
+		if _, ok := element.(List); ok {
+			if err := writeXMLElement(buf, element); err != nil {
+				return err
+			}
+			continue
+		}
+		if i > 0 {
+			if _, ok := content[i-1].(Atom); ok {
+				return errors.Errorf("element %s: adjoining text %s and %s would merge", name, content[i-1], element)
+			}
+		}
+		text, err := xmlText(element)
+		if err != nil {
+			return errors.Wrapf(err, "element %s", name)
+		}
+		if len(bytes.TrimSpace(text)) == 0 {
+			return errors.Errorf("element %s: text %s would be discarded as whitespace", name, element)
+		}
+		xml.EscapeText(buf, text)
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// xmlNameOf returns the XML name which s must be.
+func xmlNameOf(s Sexp) (string, error) {
+	a, ok := s.(Atom)
+	if !ok || len(a.DisplayHint) > 0 || !isXMLName(a.Value) {
+		return "", errors.Errorf("%v is not an XML name", s)
+	}
+	return string(a.Value), nil
+}
+
+// isXMLName reports whether b is an XML name, approximately: a letter,
+// _ or : followed by letters, digits, _, :, - and .
+func isXMLName(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for i, r := range string(b) {
+		switch {
+		case unicode.IsLetter(r), r == '_', r == ':':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// xmlText returns the text which s must be.
+func xmlText(s Sexp) ([]byte, error) {
+	a, ok := s.(Atom)
+	switch {
+	case !ok:
+		return nil, errors.Errorf("%s is not text", s)
+	case len(a.DisplayHint) > 0:
+		return nil, errors.Errorf("display hint of %s not representable", s)
+	case !utf8.Valid(a.Value):
+		return nil, errors.Errorf("%s is not UTF-8", s)
+	}
+	for _, r := range string(a.Value) {
+		// c.f. the Char production of the XML specification
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xfffe || r == 0xffff {
+			return nil, errors.Errorf("%s contains %U, forbidden in XML", s, r)
+		}
+	}
+	return a.Value, nil
+}
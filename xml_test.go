@@ -0,0 +1,128 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestXML(t *testing.T) {
+	for _, test := range []struct {
+		sexp, xml string
+	}{
+		{"(a)", "<a/>"},
+		{"(a text)", "<a>text</a>"},
+		{`(a ("@" (href x.html) (class link)) "see " (b here) .)`, `<a href="x.html" class="link">see <b>here</b>.</a>`},
+		{`(config ("@" (xmlns:xsi "http://www.w3.org/2001/XMLSchema-instance")) (xsi:item))`,
+			`<config xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><xsi:item/></config>`},
+		{`(a "<b & \"c\">")`, "<a>&lt;b &amp; &#34;c&#34;&gt;</a>"},
+		{`(a ("@" (b "\n")))`, `<a b="&#xA;"></a>`},
+		{`(a "caf\303\251")`, "<a>café</a>"},
+	} {
+		s := parseString(t, test.sexp)
+		b, err := ToXML(s)
+		if err != nil {
+			t.Errorf("%s: %v", test.sexp, err)
+			continue
+		}
+		if string(b) != strings.Replace(test.xml, "></a>", "/>", 1) {
+			t.Errorf("%s: expected %s; got %s", test.sexp, test.xml, b)
+		}
+		result, err := FromXML([]byte(test.xml))
+		if err != nil {
+			t.Errorf("%s: %v", test.xml, err)
+			continue
+		}
+		if !bytes.Equal(result.Pack(), s.Pack()) {
+			t.Errorf("%s: expected %s; got %s", test.xml, s, result)
+		}
+	}
+}
+
+func TestFromXML(t *testing.T) {
+	for _, test := range []struct {
+		xml, sexp string
+	}{
+		{`<?xml version="1.0"?>
+<!-- settings -->
+<config>
+  <port>80</port>
+  <debug/>
+</config>
+`, `(config (port "80") (debug))`},
+		{"<a>b<!-- c -->d</a>", "(a bd)"},
+		{"<a>x &amp; <![CDATA[<y>]]></a>", `(a "x & <y>")`},
+		{"<a>  b  </a>", `(a "  b  ")`},
+		{"<a>x<![CDATA[ ]]>y</a>", `(a "x y")`},
+		{"<a>x<!-- c --> </a>", `(a "x ")`},
+		{"<a> <!-- c --> <b/></a>", "(a (b))"},
+	} {
+		s, err := FromXML([]byte(test.xml))
+		if err != nil {
+			t.Errorf("%s: %v", test.xml, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.sexp)) {
+			t.Errorf("%s: expected %s; got %s", test.xml, test.sexp, s)
+		}
+	}
+	for _, test := range []struct {
+		xml string
+		err error
+	}{
+		{"", nil},
+		{"text", nil},
+		{"<a>", io.ErrUnexpectedEOF},
+		{"<a></b>", nil},
+		{"<a/><b/>", nil},
+		{"<a/>text", nil},
+		{"<a b='1' b='2'/>", nil},
+		{strings.Repeat("<a>", 1025) + strings.Repeat("</a>", 1025), ErrLimitExceeded},
+	} {
+		s, err := FromXML([]byte(test.xml))
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%q: expected error %v; got %v, %v", test.xml, test.err, s, err)
+		}
+	}
+}
+
+func TestToXMLErrors(t *testing.T) {
+	for _, sexp := range []string{
+		"a",
+		"()",
+		"((a))",
+		"([h]a)",
+		`("1a")`,
+		"(a [h]b)",
+		`(a "\000")`,
+		"(a #ff#)",
+		"(a b (c) d e)",
+		`(a " ")`,
+		`(a "")`,
+		`(a ("@"))`,
+		`(a ("@" b))`,
+		`(a ("@" (b c d)))`,
+		`(a ("@" (b (c))))`,
+	} {
+		if b, err := ToXML(parseString(t, sexp)); err == nil {
+			t.Errorf("%s: expected error; got %s", sexp, b)
+		}
+	}
+}
+
+func ExampleFromXML() {
+	s, err := FromXML([]byte(`<server><name>www</name><port>80</port></server>`))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s.String())
+	// Output:
+	// (server (name www) (port "80"))
+}
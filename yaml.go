@@ -0,0 +1,277 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// FromYAML converts the YAML document b to an S-expression, which
+// ToYAML converts back to the same document, but for comments, styles
+// and anchors.  A scalar becomes an atom of its text.  A local tag,
+// e.g. !text/plain, becomes its display hint, as do the core tags of
+// scalars other than strings, e.g. !!int.  A sequence becomes a list of
+// its elements, and a mapping a list of (key value) pairs, in order.
+// E.g.
+//    server:
+//      host: example.com
+//      ports: [80, 443]
+// becomes
+//    ((server ((host example.com) (ports (["!!int"]"80" ["!!int"]"443")))))
+// As an S-expression cannot otherwise tell them apart, a sequence
+// which would be taken for a mapping, e.g. [[a, b], [c, d]], is headed
+// by the atom [!!seq]"", and an empty mapping is the list ([!!map]"").
+// Aliases are expanded.  Merge keys (<<), global tags other than the
+// core ones, and tags on sequences other than !!seq and on mappings
+// other than !!map are an error.
+func FromYAML(b []byte) (Sexp, error) {
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	var doc yaml.Node
+	if err := d.Decode(&doc); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("YAML: no document")
+		}
+		return nil, errors.Wrap(err, "YAML")
+	}
+	var next yaml.Node
+	if err := d.Decode(&next); err != io.EOF {
+		if err != nil {
+			return nil, errors.Wrap(err, "YAML")
+		}
+		return nil, errors.New("YAML: more than one document")
+	}
+	// each node but those reached through aliases occupies at least a
+	// byte, so this only limits how far aliases may expand
+	y := &yamlReader{budget: 64*len(b) + 1024}
+	s, err := y.read(&doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML")
+	}
+	return s, nil
+}
+
+type yamlReader struct {
+	depth  int
+	budget int // the number of nodes which may yet be read
+}
+
+// yamlCoreTags are the core tags of scalars which are kept as display
+// hints.
+var yamlCoreTags = map[string]bool{
+	"!!null":      true,
+	"!!bool":      true,
+	"!!int":       true,
+	"!!float":     true,
+	"!!timestamp": true,
+	"!!binary":    true,
+}
+
+// yamlMarker returns the atom heading a list which must be converted to
+// a YAML collection of the given kind, !!seq or !!map.
+func yamlMarker(kind string) Atom {
+	return Atom{DisplayHint: []byte(kind), Value: []byte{}}
+}
+
+func (y *yamlReader) read(n *yaml.Node) (Sexp, error) {
+	if y.budget--; y.budget < 0 {
+		return nil, errors.New("aliases expand too far")
+	}
+	if max := DefaultLimits.MaxDepth; max > 0 && y.depth >= max {
+		return nil, &LimitError{Limit: "MaxDepth", Max: int64(max)}
+	}
+	y.depth++
+	defer func() { y.depth-- }()
+	tag := n.ShortTag()
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, errors.New("empty document")
+		}
+		return y.read(n.Content[0])
+	case yaml.AliasNode:
+		return y.read(n.Alias)
+	case yaml.ScalarNode:
+		a := Atom{Value: []byte(n.Value)}
+		switch {
+		case tag == "!!str":
+		case yamlCoreTags[tag]:
+			a.DisplayHint = []byte(tag)
+		case tag == "!!merge":
+			return nil, errors.Errorf("line %d: merge keys unsupported", n.Line)
+		case strings.HasPrefix(tag, "!") && !strings.HasPrefix(tag, "!!"):
+			a.DisplayHint = []byte(tag[1:])
+		default:
+			return nil, errors.Errorf("line %d: tag %s not representable", n.Line, tag)
+		}
+		return a, nil
+	case yaml.SequenceNode, yaml.MappingNode:
+		kind := "!!seq"
+		if n.Kind == yaml.MappingNode {
+			kind = "!!map"
+		}
+		if tag != kind {
+			return nil, errors.Errorf("line %d: tag %s of a collection not representable", n.Line, tag)
+		}
+		l := List{}
+		for _, element := range n.Content {
+			s, err := y.read(element)
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, s)
+		}
+		if n.Kind == yaml.SequenceNode {
+			if isYAMLMapping(l) {
+				l = append(List{yamlMarker("!!seq")}, l...)
+			}
+			return l, nil
+		}
+		if len(l) == 0 {
+			return List{yamlMarker("!!map")}, nil
+		}
+		pairs := make(List, 0, len(l)/2)
+		for i := 0; i+1 < len(l); i += 2 {
+			pairs = append(pairs, List{l[i], l[i+1]})
+		}
+		if !isYAMLMapping(pairs) {
+			return nil, errors.Errorf("line %d: duplicate keys", n.Line)
+		}
+		return pairs, nil
+	}
+	return nil, errors.Errorf("line %d: unknown node kind %d", n.Line, n.Kind)
+}
+
+// ToYAML converts s to a YAML document, reversing FromYAML.  A list of
+// two-element lists with distinct first elements becomes a mapping,
+// unless it is headed by [!!seq]""; any other list becomes a sequence.
+// An atom becomes a string, unless its display hint is a core tag or
+// names a local tag.  It is an error for s to contain anything which
+// FromYAML would not convert back to the same S-expression: atoms which
+// are not UTF-8; display hints which are neither core tags, other than
+// !!str, nor valid local tags; and lists headed by [!!seq]"" or
+// [!!map]"" where FromYAML would not have put them.
+func ToYAML(s Sexp) ([]byte, error) {
+	n, err := yamlNode(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML")
+	}
+	buf := bytes.NewBuffer(nil)
+	e := yaml.NewEncoder(buf)
+	e.SetIndent(2)
+	if err = e.Encode(n); err == nil {
+		err = e.Close()
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "YAML")
+	}
+	return buf.Bytes(), nil
+}
+
+func yamlNode(s Sexp) (*yaml.Node, error) {
+	switch s := s.(type) {
+	case Atom:
+		if !utf8.Valid(s.Value) {
+			return nil, errors.Errorf("%s is not UTF-8", s)
+		}
+		n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(s.Value)}
+		if n.Value == "<<" {
+			// which would otherwise be a merge key
+			n.Style = yaml.DoubleQuotedStyle
+		}
+		switch hint := string(s.DisplayHint); {
+		case hint == "":
+		case yamlCoreTags[hint]:
+			n.Tag = hint
+		case isYAMLTag(s.DisplayHint):
+			n.Tag = "!" + hint
+		default:
+			return nil, errors.Errorf("display hint of %s not representable as a tag", s)
+		}
+		return n, nil
+	case List:
+		n := &yaml.Node{Kind: yaml.SequenceNode}
+		elements := s
+		switch {
+		case len(s) > 0 && s[0].Equal(yamlMarker("!!seq")):
+			if elements = s[1:]; !isYAMLMapping(elements) {
+				return nil, errors.Errorf("%s: needlessly marked as a sequence", s)
+			}
+		case len(s) > 0 && s[0].Equal(yamlMarker("!!map")):
+			if len(s) > 1 {
+				return nil, errors.Errorf("%s: needlessly marked as a mapping", s)
+			}
+			return &yaml.Node{Kind: yaml.MappingNode}, nil
+		case isYAMLMapping(s):
+			n.Kind = yaml.MappingNode
+		}
+		for _, element := range elements {
+			if n.Kind == yaml.MappingNode {
+				pair := element.(List)
+				key, err := yamlNode(pair[0])
+				if err != nil {
+					return nil, err
+				}
+				value, err := yamlNode(pair[1])
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, key, value)
+				continue
+			}
+			child, err := yamlNode(element)
+			if err != nil {
+				return nil, err
+			}
+			n.Content = append(n.Content, child)
+		}
+		return n, nil
+	}
+	return nil, errors.Errorf("can't convert %T to YAML", s)
+}
+
+// isYAMLMapping reports whether l is a non-empty list of (key value)
+// pairs with distinct keys.
+func isYAMLMapping(l List) bool {
+	if len(l) == 0 {
+		return false
+	}
+	keys := make(map[string]bool, len(l))
+	for _, element := range l {
+		pair, ok := element.(List)
+		if !ok || len(pair) != 2 {
+			return false
+		}
+		key := string(pair[0].Pack())
+		if keys[key] {
+			return false
+		}
+		keys[key] = true
+	}
+	return true
+}
+
+// isYAMLTag reports whether !hint is a local tag, i.e. hint is a
+// non-empty sequence of the characters in the ns-tag-char production of
+// the YAML specification, excluding % escapes.
+func isYAMLTag(hint []byte) bool {
+	if len(hint) == 0 {
+		return false
+	}
+	for _, c := range hint {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-#;/?:@&=+$_.~*'()", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,186 @@
+// Copyright 2013 Robert A. Uhl.  All rights reserved.
+// Use of this source code is governed by an MIT-style license which may
+// be found in the LICENSE file.
+
+package sexprs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAML(t *testing.T) {
+	for _, test := range []struct {
+		sexp, yaml string
+	}{
+		{"foo", "foo\n"},
+		{`""`, `""` + "\n"},
+		{`"80"`, `"80"` + "\n"},
+		{"null", `"null"` + "\n"},
+		{"true", `"true"` + "\n"},
+		{`(("<<" x))`, `"<<": x` + "\n"},
+		{`"a: b"`, `'a: b'` + "\n"},
+		{"[text/plain]foo", "!text/plain foo\n"},
+		{"()", "[]\n"},
+		{`(["!!map"]"")`, "{}\n"},
+		{`["!!int"]"80"`, "80\n"},
+		{`["!!bool"]true`, "true\n"},
+		{`["!!int"]abc`, "!!int abc\n"},
+		{`((a ["!!null"]"") (b ["!!null"]"~"))`, "a:\nb: ~\n"},
+		{"(a b)", "- a\n- b\n"},
+		{"((host example.com) (ports (\"80\" \"443\")))", "host: example.com\nports:\n  - \"80\"\n  - \"443\"\n"},
+		{"((a (b c)) (d ((e f))))", "a:\n  - b\n  - c\nd:\n  e: f\n"},
+		{"(((a) b))", "? - a\n: b\n"},
+		// not mappings
+		{"((a b) c)", "- - a\n  - b\n- c\n"},
+		{"((a b) (a c))", "- - a\n  - b\n- - a\n  - c\n"},
+		{`(["!!seq"]"" (a b) (c d))`, "- - a\n  - b\n- - c\n  - d\n"},
+	} {
+		s := parseString(t, test.sexp)
+		b, err := ToYAML(s)
+		if err != nil {
+			t.Errorf("%s: %v", test.sexp, err)
+			continue
+		}
+		if string(b) != test.yaml {
+			t.Errorf("%s: expected %q; got %q", test.sexp, test.yaml, b)
+		}
+		result, err := FromYAML(b)
+		if err != nil {
+			t.Errorf("%s: %s: %v", test.sexp, b, err)
+			continue
+		}
+		if !bytes.Equal(result.Pack(), s.Pack()) {
+			t.Errorf("%s: %s round-tripped to %s", test.sexp, b, result)
+		}
+	}
+}
+
+// TestYAMLRoundTrip checks that YAML converted to an S-expression and
+// back has the same meaning.
+func TestYAMLRoundTrip(t *testing.T) {
+	for _, input := range []string{
+		"- [a, b]\n- [c, d]\n",
+		"port: 80\nok: true\nratio: 0.5\nnothing: ~\nempty:\nquoted: \"80\"\n",
+		"when: 2001-12-14\ndata: !!binary aGVsbG8=\nplain: !text/plain foo\n",
+		"a: {}\nb: []\nc: [{}, []]\n",
+		"{}",
+	} {
+		s, err := FromYAML([]byte(input))
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		b, err := ToYAML(s)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		var expected, result interface{}
+		if err = yaml.Unmarshal([]byte(input), &expected); err != nil {
+			t.Fatal(err)
+		}
+		if err = yaml.Unmarshal(b, &result); err != nil {
+			t.Errorf("%q: %q: %v", input, b, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("%q: round-tripped to %q", input, b)
+		}
+	}
+}
+
+func TestFromYAML(t *testing.T) {
+	for _, test := range []struct {
+		yaml, sexp string
+	}{
+		{"# settings\nport: 80\ndebug: true\n", `((port ["!!int"]"80") (debug ["!!bool"]true))`},
+		{"[1, 2.5, ~, null]", `(["!!int"]"1" ["!!float"]"2.5" ["!!null"]"~" ["!!null"]null)`},
+		{"a:\nb: 1", `((a ["!!null"]"") (b ["!!int"]"1"))`},
+		{"? [a, b]\n: c", `(((a b) c))`},
+		{"!h ~", `[h]"~"`},
+		{"!!str 80", `"80"`},
+		{"base: &b {x: a}\ncopy: *b", `((base ((x a))) (copy ((x a))))`},
+		{`"<<": {x: a}`, `(("<<" ((x a))))`},
+		{"- [a, b]", `(["!!seq"]"" (a b))`},
+		{"[[a, b], c]", "((a b) c)"},
+		{"{}", `(["!!map"]"")`},
+		{"text: |\n  line\n", `((text "line\n"))`},
+		{"---\nfoo\n...\n", "foo"},
+	} {
+		s, err := FromYAML([]byte(test.yaml))
+		if err != nil {
+			t.Errorf("%q: %v", test.yaml, err)
+			continue
+		}
+		if !s.Equal(parseString(t, test.sexp)) {
+			t.Errorf("%q: expected %s; got %s", test.yaml, test.sexp, s)
+		}
+	}
+	// each level doubles the size of the expansion
+	var laughs strings.Builder
+	laughs.WriteString("a0: &a0 [lol, lol]\n")
+	for i := 1; i < 30; i++ {
+		fmt.Fprintf(&laughs, "a%d: &a%d [*a%d, *a%d]\n", i, i, i-1, i-1)
+	}
+	for _, test := range []struct {
+		yaml string
+		err  error
+	}{
+		{"", nil},
+		{"a: [b", nil},
+		{"a\n---\nb", nil},
+		{"!h [a]", nil},
+		{"!h {a: b}", nil},
+		{"!!set {a, b}", nil},
+		{"!!map [a, b]", nil},
+		{"!!seq {a: b}", nil},
+		{"<<: {x: 1}", nil},
+		{"!<tag:example.com,2000:x> a", nil},
+		{"{a: 1, a: 2}", nil},
+		{laughs.String(), nil},
+		{strings.Repeat("[", 1025) + strings.Repeat("]", 1025), ErrLimitExceeded},
+	} {
+		s, err := FromYAML([]byte(test.yaml))
+		if err == nil || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("%.40q: expected error %v; got %v, %v", test.yaml, test.err, s, err)
+		}
+	}
+}
+
+func TestToYAMLErrors(t *testing.T) {
+	for _, sexp := range []string{
+		"#ff#",
+		"(a #ff#)",
+		`["a b"]c`,
+		`["!a"]b`,
+		`["caf\303\251"]b`,
+		"((k [h]#ff#))",
+		`["!!str"]a`,
+		`["!!seq"]""`,
+		`(["!!seq"]"")`,
+		`(["!!seq"]"" a)`,
+		`(["!!seq"]"" (a b) (a c))`,
+		`(["!!map"]"" (a b))`,
+	} {
+		if b, err := ToYAML(parseString(t, sexp)); err == nil {
+			t.Errorf("%s: expected error; got %s", sexp, b)
+		}
+	}
+}
+
+func ExampleFromYAML() {
+	s, err := FromYAML([]byte("server:\n  host: example.com\n  aliases: [www, web]\n"))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(s.String())
+	// Output:
+	// ((server ((host example.com) (aliases (www web)))))
+}